@@ -0,0 +1,118 @@
+package ebitmx
+
+import (
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Frame is a single frame of a tile animation
+type Frame struct {
+	TileID int `xml:"tileid,attr"`
+	// Duration in milliseconds
+	Duration int `xml:"duration,attr"`
+}
+
+// SetAnimationTime sets the animation clock to an absolute time, so rendering
+// shows exactly the frames for that point in time
+func (t *TmxMap) SetAnimationTime(d time.Duration) {
+	t.animationTime = d
+}
+
+// Update advances the animation clock by dt, call it once per game tick
+func (t *TmxMap) Update(dt time.Duration) {
+	t.animationTime += dt
+}
+
+// AnimationTime returns the current value of the animation clock
+func (t *TmxMap) AnimationTime() time.Duration {
+	return t.animationTime
+}
+
+// TileImage returns the image of the tile at the given animation time.
+// For tiles without animation this is the tile itself.
+func (t *Tileset) TileImage(internalID int, at time.Duration) *ebiten.Image {
+	if def := t.TileDefinition(internalID); def != nil && len(def.Animation) > 0 {
+		internalID = frameAt(def.Animation, at)
+	}
+	if img, ok := t.overrides[internalID]; ok {
+		return img
+	}
+	return t.Tiles[internalID]
+}
+
+func (t *Tileset) isAnimated(internalID int) bool {
+	def := t.TileDefinition(internalID)
+	return def != nil && len(def.Animation) > 0
+}
+
+// frameAt returns the tile id of the frame shown at the given time, looping the animation
+func frameAt(frames []Frame, at time.Duration) int {
+	total := 0
+	for _, frame := range frames {
+		total += frame.Duration
+	}
+	if total <= 0 {
+		return frames[0].TileID
+	}
+
+	ms := int(at.Milliseconds() % int64(total))
+	if ms < 0 {
+		ms += total
+	}
+	for _, frame := range frames {
+		if ms < frame.Duration {
+			return frame.TileID
+		}
+		ms -= frame.Duration
+	}
+	return frames[len(frames)-1].TileID
+}
+
+// AnimatedSprite plays the animation of a tileset tile on its own, e.g. for an entity outside of the map grid
+type AnimatedSprite struct {
+	tileset    *Tileset
+	internalID int
+	elapsed    time.Duration
+}
+
+// AnimatedSprite returns a sprite playing the animation of the given tile.
+// ok is false if the tile has no animation.
+func (t *Tileset) AnimatedSprite(internalID int) (*AnimatedSprite, bool) {
+	if !t.isAnimated(internalID) {
+		return nil, false
+	}
+	return &AnimatedSprite{tileset: t, internalID: internalID}, true
+}
+
+// Update advances the animation by dt
+func (s *AnimatedSprite) Update(dt time.Duration) {
+	s.elapsed += dt
+}
+
+// Draw draws the current frame onto dst. op may be nil.
+func (s *AnimatedSprite) Draw(dst *ebiten.Image, op *ebiten.DrawImageOptions) {
+	if op == nil {
+		op = &ebiten.DrawImageOptions{}
+	}
+	dst.DrawImage(s.tileset.TileImage(s.internalID, s.elapsed), op)
+}
+
+// VisibleAnimatedTiles returns the animated tiles of all layers within the camera view
+func (t *TmxMap) VisibleAnimatedTiles(scale float64) []*Tile {
+	visible := t.VisibleTileRange(scale)
+
+	var tiles []*Tile
+	for _, layer := range t.Layers {
+		layer.ensureDecoded()
+		for _, tile := range layer.Tiles {
+			if tile.X < visible.Min.X || tile.X > visible.Max.X || tile.Y < visible.Min.Y || tile.Y > visible.Max.Y {
+				continue
+			}
+			if tile.Tileset.isAnimated(int(tile.InternalTileID)) {
+				tiles = append(tiles, tile)
+			}
+		}
+	}
+	return tiles
+}
@@ -0,0 +1,185 @@
+package ebitmx
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// animatedTSX animates tile 0 through tiles 1, 2 and 3, showing each for 100ms
+const animatedTSX = ` <tile id="0">
+  <animation>
+   <frame tileid="1" duration="100"/>
+   <frame tileid="2" duration="100"/>
+   <frame tileid="3" duration="100"/>
+  </animation>
+ </tile>
+`
+
+func loadAnimatedMap(t testing.TB, tmx string) *TmxMap {
+	t.Helper()
+	fsys := newTestFS(tmx)
+	fsys["tiles.tsx"].Data = []byte(testTSX(animatedTSX))
+	return loadTestMapFS(t, fsys)
+}
+
+func TestFrameAt(t *testing.T) {
+	frames := []Frame{{TileID: 1, Duration: 100}, {TileID: 2, Duration: 50}, {TileID: 3, Duration: 100}}
+	tests := []struct {
+		at   time.Duration
+		want int
+	}{
+		{0, 1},
+		{99 * time.Millisecond, 1},
+		{100 * time.Millisecond, 2},
+		{149 * time.Millisecond, 2},
+		{150 * time.Millisecond, 3},
+		{250 * time.Millisecond, 1},
+		{-10 * time.Millisecond, 3},
+	}
+	for _, test := range tests {
+		if got := frameAt(frames, test.at); got != test.want {
+			t.Errorf("frame at %s is %d, want %d", test.at, got, test.want)
+		}
+	}
+	if got := frameAt([]Frame{{TileID: 7}}, time.Second); got != 7 {
+		t.Errorf("frame of an animation without duration is %d, want 7", got)
+	}
+}
+
+func TestAnimationTimeDeterministic(t *testing.T) {
+	gameMap := loadAnimatedMap(t, testTMX(2, 1, csvLayer(1, "water", 2, 1, 1, 5)))
+	layer := gameMap.Layers[0]
+
+	gameMap.SetAnimationTime(150 * time.Millisecond)
+	rendered := layer.render(gameMap, false)
+	first := pixelAt(rendered, 8, 8)
+	if first != tileColor(2) {
+		t.Fatalf("animated tile at 150ms has color %v, want frame tile 2 %v", first, tileColor(2))
+	}
+
+	gameMap.SetAnimationTime(250 * time.Millisecond)
+	if got := pixelAt(layer.render(gameMap, false), 8, 8); got != tileColor(3) {
+		t.Errorf("animated tile at 250ms has color %v, want frame tile 3 %v", got, tileColor(3))
+	}
+	gameMap.SetAnimationTime(150 * time.Millisecond)
+	again := layer.render(gameMap, false)
+	if got := pixelAt(again, 8, 8); got != first {
+		t.Errorf("rendering 150ms again gave %v, want %v", got, first)
+	}
+	if got := pixelAt(again, 24, 8); got != tileColor(4) {
+		t.Errorf("static tile has color %v, want %v", got, tileColor(4))
+	}
+	if again != rendered {
+		t.Error("animation ticks allocated a new render")
+	}
+}
+
+func TestVisibleAnimatedTiles(t *testing.T) {
+	// animated tiles at 0,0, 2,1 and 7,3, a static one at 1,1
+	gameMap := loadAnimatedMap(t, testTMX(8, 4, csvLayer(1, "water", 8, 4,
+		1, 0, 0, 0, 0, 0, 0, 0,
+		0, 2, 1, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 1,
+	)))
+	gameMap.CameraBounds = image.Rect(0, 0, 48, 32)
+	gameMap.CameraPosition = image.Pt(24, 16)
+
+	tiles := gameMap.VisibleAnimatedTiles(1)
+	if len(tiles) != 2 || tiles[0].X != 0 || tiles[0].Y != 0 || tiles[1].X != 2 || tiles[1].Y != 1 {
+		t.Errorf("visible animated tiles %v, want those at 0,0 and 2,1", tilePositions(tiles))
+	}
+
+	gameMap.CameraPosition = image.Pt(104, 48)
+	tiles = gameMap.VisibleAnimatedTiles(1)
+	if len(tiles) != 1 || tiles[0].X != 7 || tiles[0].Y != 3 {
+		t.Errorf("visible animated tiles %v, want the one at 7,3", tilePositions(tiles))
+	}
+}
+
+func tilePositions(tiles []*Tile) []image.Point {
+	points := make([]image.Point, len(tiles))
+	for i, tile := range tiles {
+		points[i] = image.Pt(tile.X, tile.Y)
+	}
+	return points
+}
+
+func TestInlineTilesetAnimation(t *testing.T) {
+	tmx := strings.Replace(testTMX(1, 1, csvLayer(1, "water", 1, 1, 1)), ` <tileset firstgid="1" source="tiles.tsx"/>`,
+		` <tileset firstgid="1" name="tiles" tilewidth="16" tileheight="16" tilecount="16" columns="4">
+  <image source="tiles.png" width="64" height="64"/>
+`+animatedTSX+` </tileset>`, 1)
+	gameMap := loadTestMap(t, tmx)
+	layer := gameMap.Layers[0]
+
+	if def := layer.Tiles[0].Definition(); def == nil || len(def.Animation) != 3 {
+		t.Fatalf("inline tile definition %+v has no animation", def)
+	}
+	gameMap.SetAnimationTime(150 * time.Millisecond)
+	if got := pixelAt(layer.render(gameMap, false), 8, 8); got != tileColor(2) {
+		t.Errorf("animated tile at 150ms has color %v, want frame tile 2 %v", got, tileColor(2))
+	}
+}
+
+func TestAnimatedSprite(t *testing.T) {
+	tileset := loadAnimatedMap(t, testTMX(1, 1, csvLayer(1, "water", 1, 1, 1))).Tilesets[0]
+	if _, ok := tileset.AnimatedSprite(1); ok {
+		t.Error("got a sprite for a tile without animation")
+	}
+	sprite, ok := tileset.AnimatedSprite(0)
+	if !ok {
+		t.Fatal("no sprite for the animated tile")
+	}
+
+	dst := ebiten.NewImage(32, 32)
+	for _, step := range []struct {
+		dt   time.Duration
+		want int
+	}{
+		{0, 1},
+		{120 * time.Millisecond, 2},
+		{100 * time.Millisecond, 3},
+		{100 * time.Millisecond, 1},
+	} {
+		sprite.Update(step.dt)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(16, 16)
+		sprite.Draw(dst, op)
+		if got := pixelAt(dst, 24, 24); got != tileColor(step.want) {
+			t.Errorf("sprite after %s shows %v, want frame tile %d", sprite.elapsed, got, step.want)
+		}
+	}
+	if got := pixelAt(dst, 8, 8); got != (color.RGBA{}) {
+		t.Errorf("sprite drawn outside of its position, %v at 8,8", got)
+	}
+}
+
+func TestUpdateAdvancesFrames(t *testing.T) {
+	gameMap := loadAnimatedMap(t, testTMX(1, 1, csvLayer(1, "water", 1, 1, 1)))
+	layer := gameMap.Layers[0]
+
+	// frames of 100ms each, looping after 300ms
+	for _, step := range []struct {
+		dt   time.Duration
+		want int
+	}{
+		{0, 1},
+		{99 * time.Millisecond, 1},
+		{1 * time.Millisecond, 2},
+		{100 * time.Millisecond, 3},
+		{99 * time.Millisecond, 3},
+		{1 * time.Millisecond, 1},
+		{250 * time.Millisecond, 3},
+	} {
+		gameMap.Update(step.dt)
+		if got := pixelAt(layer.render(gameMap, false), 8, 8); got != tileColor(step.want) {
+			t.Errorf("at %s the tile shows %v, want frame tile %d", gameMap.AnimationTime(), got, step.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package ebitmx
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+)
+
+// NewMap creates an empty orthogonal map to be filled programmatically
+func NewMap(width, height, tileW, tileH int) *TmxMap {
+	return &TmxMap{
+		Orientation:      Orthogonal,
+		Compressionlevel: -1,
+		Renderorder:      RightDown,
+		Width:            width,
+		Height:           height,
+		TileWidth:        tileW,
+		TileHeight:       tileH,
+		PixelWidth:       width * tileW,
+		PixelHeight:      height * tileH,
+		NextLayerID:      1,
+		NextObjectID:     1,
+		options:          newLoadOptions(nil),
+	}
+}
+
+// AddTileset adds a tileset to the map. If FirstGid is unset the tileset is assigned
+// the first gid after the existing tilesets. The tileset needs TilesetEbitenImage set,
+// its tile images are sliced from it if Tiles is empty.
+func (t *TmxMap) AddTileset(ts *Tileset) {
+	if ts.FirstGid == 0 {
+		ts.FirstGid = 1
+		for _, existing := range t.Tilesets {
+			if next := existing.FirstGid + uint32(existing.tileIDLimit()); next > ts.FirstGid {
+				ts.FirstGid = next
+			}
+		}
+	}
+	if ts.Tiles == nil && ts.TilesetEbitenImage != nil {
+		ts.sliceTiles()
+	}
+	ts.indexTileDefinitions()
+
+	t.Tilesets = append(t.Tilesets, ts)
+}
+
+// AddTileLayer adds a tile layer spanning the whole map from a row-major grid of gids.
+// Gids may include flip flags, 0 marks an empty cell. The layer isn't added if a gid
+// doesn't resolve to a tileset.
+func (t *TmxMap) AddTileLayer(name string, gids []uint32) (*Layer, error) {
+	layer := &Layer{
+		ID:      uint(t.NextLayerID),
+		Name:    name,
+		Width:   t.Width,
+		Height:  t.Height,
+		Opacity: 1,
+		Visible: true,
+	}
+	if err := layer.setGIDs(t, image.Rect(0, 0, t.Width, t.Height), gids); err != nil {
+		return nil, fmt.Errorf("layer '%s': %w", name, err)
+	}
+	t.NextLayerID++
+
+	t.Layers = append(t.Layers, layer)
+	t.LayerStack = append(t.LayerStack, &LayerEntry{Layer: layer})
+	return layer, nil
+}
+
+// setGIDs replaces the layer data with the given row-major gids covering bounds and decodes it.
+// Bounds other than the layer size, as of infinite maps, are written as a single chunk.
+func (l *Layer) setGIDs(gameMap *TmxMap, bounds image.Rectangle, gids []uint32) error {
+	data := make([]byte, 4*len(gids))
+	for i, gid := range gids {
+		binary.LittleEndian.PutUint32(data[4*i:], gid)
+	}
+	text := base64.StdEncoding.EncodeToString(data)
+	l.Data.Encoding = Base64
+	l.Data.Compression = ""
+	if bounds != image.Rect(0, 0, l.Width, l.Height) {
+		l.Data.Text = ""
+		l.Data.Chunks = []Chunk{{X: bounds.Min.X, Y: bounds.Min.Y, Width: bounds.Dx(), Height: bounds.Dy(), Text: text}}
+	} else {
+		l.Data.Text = text
+		l.Data.Chunks = nil
+	}
+	l.dataHash = l.hashData()
+
+	l.Tiles = nil
+	return l.DecodeData(gameMap)
+}
+
+// Overlay appends the layers, object groups and image layers of other on top of the receiver's,
+// e.g. to add a per-level foreground to a shared background map. Tilesets of other that the receiver
+// doesn't reference yet are added and the gids of the appended layers and objects remapped
+// accordingly. Layers and objects get new ids. Both maps must use the same tile size.
+func (t *TmxMap) Overlay(other *TmxMap) error {
+	if t.TileWidth != other.TileWidth || t.TileHeight != other.TileHeight {
+		return fmt.Errorf("tile size %dx%d doesn't match %dx%d", other.TileWidth, other.TileHeight, t.TileWidth, t.TileHeight)
+	}
+
+	firstGids := make(map[*Tileset]uint32)
+	for _, tileset := range other.Tilesets {
+		for _, existing := range t.Tilesets {
+			if tileset == existing || (tileset.Source != "" && tileset.Source == existing.Source) {
+				firstGids[tileset] = existing.FirstGid
+				break
+			}
+		}
+		if _, ok := firstGids[tileset]; !ok {
+			added := *tileset
+			added.FirstGid = 0
+			t.AddTileset(&added)
+			firstGids[tileset] = added.FirstGid
+		}
+	}
+	remap := func(gid uint32) (uint32, error) {
+		id, flags := DecodeGID(gid)
+		if id == 0 {
+			return 0, nil
+		}
+		tileset := other.TilesetForGID(id)
+		if tileset == nil {
+			return 0, fmt.Errorf("couldn't find tileset for gid %d", id)
+		}
+		return (id - tileset.FirstGid + firstGids[tileset]) | uint32(flags), nil
+	}
+
+	for _, entry := range other.LayerStack {
+		switch {
+		case entry.Layer != nil:
+			gids := entry.Layer.RawGIDs()
+			for i := range gids {
+				gid, err := remap(gids[i])
+				if err != nil {
+					return err
+				}
+				gids[i] = gid
+			}
+
+			// only the attributes are taken over, the render state belongs to the other map
+			src := entry.Layer
+			layer := &Layer{
+				ID:         uint(t.NextLayerID),
+				Name:       src.Name,
+				Class:      src.Class,
+				X:          src.X,
+				Y:          src.Y,
+				Width:      src.Width,
+				Height:     src.Height,
+				Opacity:    src.Opacity,
+				Visible:    src.Visible,
+				Tintcolor:  src.Tintcolor,
+				Offsetx:    src.Offsetx,
+				Offsety:    src.Offsety,
+				Properties: src.Properties,
+			}
+			t.NextLayerID++
+			if err := layer.setGIDs(t, src.Bounds(), gids); err != nil {
+				return err
+			}
+			t.Layers = append(t.Layers, layer)
+			t.LayerStack = append(t.LayerStack, &LayerEntry{Layer: layer})
+
+		case entry.ObjectGroup != nil:
+			group := *entry.ObjectGroup
+			group.ID = t.NextLayerID
+			group.Rendered = nil
+			group.Objects = nil
+			t.NextLayerID++
+			for _, original := range entry.ObjectGroup.Objects {
+				object := *original
+				object.ID = t.NextObjectID
+				t.NextObjectID++
+				if object.Gid != 0 {
+					gid, err := remap(object.Gid)
+					if err != nil {
+						return err
+					}
+					object.Gid = gid
+					object.Tile = TileFromGID(gid)
+					object.Tile.Tileset = t.TilesetForGID(object.Tile.GlobalTileID)
+					object.Tile.InternalTileID = object.Tile.GlobalTileID - object.Tile.Tileset.FirstGid
+				}
+				group.Objects = append(group.Objects, &object)
+			}
+			t.ObjectGroups = append(t.ObjectGroups, &group)
+			t.LayerStack = append(t.LayerStack, &LayerEntry{ObjectGroup: &group})
+
+		case entry.ImageLayer != nil:
+			layer := *entry.ImageLayer
+			layer.ID = uint(t.NextLayerID)
+			layer.Rendered = nil
+			t.NextLayerID++
+			t.ImageLayers = append(t.ImageLayers, &layer)
+			t.LayerStack = append(t.LayerStack, &LayerEntry{ImageLayer: &layer})
+		}
+	}
+
+	t.InvalidateCollisionIndex()
+	return nil
+}
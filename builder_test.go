@@ -0,0 +1,94 @@
+package ebitmx
+
+import "testing"
+
+func TestNewMap(t *testing.T) {
+	gameMap := NewMap(3, 2, 16, 16)
+	gameMap.AddTileset(testTileset())
+	if gameMap.Tilesets[0].FirstGid != 1 {
+		t.Fatalf("tileset got firstgid %d, want 1", gameMap.Tilesets[0].FirstGid)
+	}
+	layer, err := gameMap.AddTileLayer("ground", []uint32{
+		1, 0, 3,
+		0, 6 | FLIPPED_HORIZONTALLY_FLAG, 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gameMap.options.maxChunks != defaultMaxChunks || gameMap.options.maxDecompressedSize != defaultMaxDecompressedSize {
+		t.Errorf("map has chunk limit %d and decompression limit %d, want the defaults", gameMap.options.maxChunks, gameMap.options.maxDecompressedSize)
+	}
+	if layer.ID != 1 || gameMap.NextLayerID != 2 || len(layer.Tiles) != 3 {
+		t.Errorf("layer has id %d and %d tiles, next layer id %d", layer.ID, len(layer.Tiles), gameMap.NextLayerID)
+	}
+
+	full := gameMap.RenderFull(1)
+	for _, cell := range []struct{ x, y, id int }{{0, 0, 0}, {2, 0, 2}, {1, 1, 5}} {
+		if got := pixelAt(full, cell.x*16+8, cell.y*16+8); got != tileColor(cell.id) {
+			t.Errorf("cell %d,%d has color %v, want %v", cell.x, cell.y, got, tileColor(cell.id))
+		}
+	}
+	if got := pixelAt(full, 16+15, 16); got != white {
+		t.Errorf("flipped tile has no marker in its top right corner, got %v", got)
+	}
+	if got := pixelAt(full, 24, 8); got.A != 0 {
+		t.Errorf("empty cell has color %v", got)
+	}
+
+	if _, err := gameMap.AddTileLayer("broken", []uint32{1, 99, 0, 0, 0, 0}); err == nil {
+		t.Error("adding a layer with an unresolved gid didn't fail")
+	}
+	if len(gameMap.Layers) != 1 || gameMap.NextLayerID != 2 {
+		t.Errorf("failed layer was added, map has %d layers", len(gameMap.Layers))
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	base := NewMap(2, 1, 16, 16)
+	base.AddTileset(testTileset())
+	if _, err := base.AddTileLayer("background", []uint32{1, 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	overlay := NewMap(2, 1, 16, 16)
+	overlay.AddTileset(testTileset())
+	foreground, err := overlay.AddTileLayer("foreground", []uint32{2 | FLIPPED_VERTICALLY_FLAG, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreground.render(overlay, false)
+	group := &ObjectGroup{ID: overlay.NextLayerID, Name: "items", Visible: true, Objects: []*Object{{ID: 1, Gid: 3, Y: 16, Width: 16, Height: 16}}}
+	sky := &ImageLayer{ID: uint(overlay.NextLayerID + 1), Name: "sky", Visible: true, Opacity: 1}
+	overlay.NextLayerID += 2
+	overlay.ObjectGroups = append(overlay.ObjectGroups, group)
+	overlay.ImageLayers = append(overlay.ImageLayers, sky)
+	overlay.LayerStack = append(overlay.LayerStack, &LayerEntry{ObjectGroup: group}, &LayerEntry{ImageLayer: sky})
+
+	if err := base.Overlay(overlay); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(base.Layers) != 2 || len(base.ObjectGroups) != 1 || len(base.ImageLayers) != 1 || len(base.LayerStack) != 4 {
+		t.Fatalf("overlaid map has %d layers, %d object groups, %d image layers and %d stack entries",
+			len(base.Layers), len(base.ObjectGroups), len(base.ImageLayers), len(base.LayerStack))
+	}
+	if len(base.Tilesets) != 2 || base.Tilesets[1].FirstGid != 17 {
+		t.Fatalf("overlay tileset wasn't added at firstgid 17")
+	}
+	added := base.Layers[1]
+	if gids := added.RawGIDs(); gids[0] != 18|FLIPPED_VERTICALLY_FLAG || gids[1] != 0 {
+		t.Errorf("overlaid layer has gids %v, want 18 flipped and 0", gids)
+	}
+	if added == foreground || added.Rendered != nil || added.ID == foreground.ID {
+		t.Error("overlaid layer shares the other map's layer state")
+	}
+	if object := base.ObjectGroups[0].Objects[0]; object.Gid != 19 || object.Tile.Tileset != base.Tilesets[1] {
+		t.Errorf("overlaid object has gid %d, want 19", object.Gid)
+	}
+	if base.ImageLayers[0].Name != "sky" || base.LayerStack[3].ImageLayer != base.ImageLayers[0] {
+		t.Error("image layer wasn't overlaid")
+	}
+	if gids := foreground.RawGIDs(); gids[0] != 2|FLIPPED_VERTICALLY_FLAG {
+		t.Errorf("the other map's layer was changed to %v", gids)
+	}
+}
@@ -0,0 +1,157 @@
+package ebitmx
+
+import (
+	"container/list"
+	"image"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const defaultMaxChunks = 64
+
+type chunkKey struct {
+	layer *Layer
+	x, y  int
+}
+
+type chunk struct {
+	key        chunkKey
+	image      *ebiten.Image
+	animated   bool
+	renderedAt time.Duration
+}
+
+// chunkCache keeps rendered chunks up to a limit, evicting the least recently used ones
+type chunkCache struct {
+	maxChunks int
+	chunks    map[chunkKey]*list.Element
+	lru       *list.List
+}
+
+func newChunkCache(maxChunks int) *chunkCache {
+	if maxChunks < 1 {
+		maxChunks = 1
+	}
+	return &chunkCache{
+		maxChunks: maxChunks,
+		chunks:    make(map[chunkKey]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+func (c *chunkCache) get(key chunkKey) *chunk {
+	elem, ok := c.chunks[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*chunk)
+}
+
+func (c *chunkCache) put(ch *chunk) {
+	if elem, ok := c.chunks[ch.key]; ok {
+		c.remove(elem)
+	}
+	c.chunks[ch.key] = c.lru.PushFront(ch)
+
+	for c.lru.Len() > c.maxChunks {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *chunkCache) remove(elem *list.Element) {
+	ch := c.lru.Remove(elem).(*chunk)
+	delete(c.chunks, ch.key)
+	ch.image.Dispose()
+}
+
+// drop removes the chunk with the given key if it's cached
+func (c *chunkCache) drop(key chunkKey) {
+	if elem, ok := c.chunks[key]; ok {
+		c.remove(elem)
+	}
+}
+
+func (c *chunkCache) clear() {
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// DrawChunked draws the camera view of the layer onto dst, scaled by scale.
+// Unlike Render it only renders the visible chunks, sized as returned by TmxMap.ChunkSize,
+// keeping them in a cache bounded by WithChunkCache. This keeps the memory use low for huge maps.
+// Tiles exceeding their cell are clipped at the chunk border.
+func (l *Layer) DrawChunked(dst *ebiten.Image, gameMap *TmxMap, scale float64) {
+	if !l.Visible {
+		return
+	}
+	if gameMap.chunks == nil {
+		gameMap.chunks = newChunkCache(gameMap.options.maxChunks)
+	}
+
+	cam := gameMap.UpdateScaledCam(scale)
+	chunkSize := gameMap.ChunkSize()
+	// the chunks of changed tiles are outdated
+	for cell := range l.changedCells {
+		gameMap.chunks.drop(chunkKey{layer: l, x: floorDiv(cell.X, chunkSize.X), y: floorDiv(cell.Y, chunkSize.Y)})
+	}
+	l.changedCells = nil
+	chunkWidth := chunkSize.X * gameMap.TileWidth
+	chunkHeight := chunkSize.Y * gameMap.TileHeight
+
+	bounds := l.Bounds()
+	op := &ebiten.DrawImageOptions{}
+	for cy := floorDiv(cam.Min.Y, chunkHeight); cy*chunkHeight < cam.Max.Y; cy++ {
+		for cx := floorDiv(cam.Min.X, chunkWidth); cx*chunkWidth < cam.Max.X; cx++ {
+			cells := image.Rect(cx*chunkSize.X, cy*chunkSize.Y, (cx+1)*chunkSize.X, (cy+1)*chunkSize.Y)
+			if !cells.Overlaps(bounds) {
+				continue
+			}
+
+			op.GeoM.Reset()
+			op.GeoM.Translate(float64(cx*chunkWidth-cam.Min.X), float64(cy*chunkHeight-cam.Min.Y))
+			op.GeoM.Scale(scale, scale)
+			dst.DrawImage(l.chunkImage(gameMap, cx, cy), op)
+		}
+	}
+}
+
+func (l *Layer) chunkImage(gameMap *TmxMap, cx, cy int) *ebiten.Image {
+	key := chunkKey{layer: l, x: cx, y: cy}
+	ch := gameMap.chunks.get(key)
+	if ch != nil && !(ch.animated && ch.renderedAt != gameMap.animationTime) {
+		return ch.image
+	}
+
+	chunkSize := gameMap.ChunkSize()
+	ch = &chunk{
+		key:        key,
+		image:      ebiten.NewImage(chunkSize.X*gameMap.TileWidth, chunkSize.Y*gameMap.TileHeight),
+		renderedAt: gameMap.animationTime,
+	}
+	cells := image.Rect(cx*chunkSize.X, cy*chunkSize.Y, (cx+1)*chunkSize.X, (cy+1)*chunkSize.Y)
+	origin := image.Pt(cells.Min.X*gameMap.TileWidth, cells.Min.Y*gameMap.TileHeight)
+	op := &ebiten.DrawImageOptions{}
+	l.ensureDecoded()
+	for _, tile := range l.tilesInRenderOrder(gameMap.Renderorder) {
+		if !image.Pt(tile.X, tile.Y).In(cells) {
+			continue
+		}
+		if l.drawTile(ch.image, gameMap, tile, origin, op) {
+			ch.animated = true
+		}
+	}
+	gameMap.chunks.put(ch)
+
+	return ch.image
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
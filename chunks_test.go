@@ -0,0 +1,95 @@
+package ebitmx
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+func TestChunkCacheEviction(t *testing.T) {
+	gids := make([]uint32, 48)
+	for i := range gids {
+		gids[i] = 1
+	}
+	gameMap := loadTestMap(t, testTMX(48, 1, csvLayer(1, "ground", 48, 1, gids...)), WithChunkCache(2))
+	layer := gameMap.Layers[0]
+	gameMap.chunks = newChunkCache(gameMap.options.maxChunks)
+
+	first := layer.chunkImage(gameMap, 0, 0)
+	second := layer.chunkImage(gameMap, 1, 0)
+	if layer.chunkImage(gameMap, 0, 0) != first {
+		t.Fatal("cached chunk was rendered again")
+	}
+	// the second chunk is the least recently used now
+	third := layer.chunkImage(gameMap, 2, 0)
+
+	if gameMap.chunks.lru.Len() != 2 {
+		t.Errorf("cache holds %d chunks, want 2", gameMap.chunks.lru.Len())
+	}
+	if gameMap.chunks.get(chunkKey{layer: layer, x: 1}) != nil || !isDisposed(second) {
+		t.Error("least recently used chunk wasn't evicted and disposed")
+	}
+	if isDisposed(first) || isDisposed(third) {
+		t.Error("cached chunks were disposed")
+	}
+
+	gameMap.InvalidateAll()
+	if gameMap.chunks.lru.Len() != 0 || !isDisposed(first) || !isDisposed(third) {
+		t.Error("InvalidateAll kept cached chunks")
+	}
+}
+
+func TestSetFlipRedraws(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(2, 1, csvLayer(1, "ground", 2, 1, 1, 2)))
+	gameMap.CameraBounds = image.Rect(0, 0, 32, 16)
+	gameMap.CameraPosition = image.Pt(16, 8)
+	layer := gameMap.Layers[0]
+	tile := layer.GetTileAt(1, 0)
+
+	drawChunked := func() *ebiten.Image {
+		dst := ebiten.NewImage(32, 16)
+		layer.DrawChunked(dst, gameMap, 1)
+		return dst
+	}
+	rendered, chunked := layer.render(gameMap, false), drawChunked()
+	if pixelAt(rendered, 16, 0) != white || pixelAt(chunked, 16, 0) != white {
+		t.Fatal("marker of the unflipped tile isn't in its top left corner")
+	}
+
+	tile.SetFlip(true, false, false)
+	rendered, chunked = layer.render(gameMap, false), drawChunked()
+	for name, img := range map[string]*ebiten.Image{"Render": rendered, "DrawChunked": chunked} {
+		if got := pixelAt(img, 31, 0); got != white {
+			t.Errorf("%s: top right corner of the flipped tile has color %v, want the marker", name, got)
+		}
+		if got := pixelAt(img, 16, 0); got != tileColor(1) {
+			t.Errorf("%s: top left corner of the flipped tile has color %v", name, got)
+		}
+		if got := pixelAt(img, 0, 0); got != white {
+			t.Errorf("%s: unchanged tile lost its marker", name)
+		}
+	}
+}
+
+func TestEditorChunkSize(t *testing.T) {
+	tmx := testTMX(8, 4, csvLayer(1, "ground", 8, 4, make([]uint32, 32)...))
+	if size := loadTestMap(t, tmx).ChunkSize(); size != image.Pt(16, 16) {
+		t.Errorf("default chunk size %v, want 16x16", size)
+	}
+
+	tmx = strings.Replace(tmx, ` <tileset`, ` <editorsettings>
+  <chunksize width="4" height="2"/>
+  <export target="map.json" format="json"/>
+ </editorsettings>
+ <tileset`, 1)
+	gameMap := loadTestMap(t, tmx)
+	if size := gameMap.ChunkSize(); size != image.Pt(4, 2) {
+		t.Errorf("chunk size %v, want 4x2", size)
+	}
+	gameMap.chunks = newChunkCache(gameMap.options.maxChunks)
+	if size := gameMap.Layers[0].chunkImage(gameMap, 1, 1).Bounds().Size(); size != image.Pt(64, 32) {
+		t.Errorf("chunk image size %v, want 64x32", size)
+	}
+}
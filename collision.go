@@ -0,0 +1,514 @@
+package ebitmx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Point is a position with sub-pixel precision, as used by polygon objects
+type Point struct {
+	X, Y float64
+}
+
+// PointList is a list of points as stored in the points attribute, e.g. "0,0 32,0 16,24"
+type PointList []Point
+
+func (p *PointList) UnmarshalXMLAttr(attr xml.Attr) error {
+	*p = nil
+	for _, pair := range strings.Fields(attr.Value) {
+		coords := strings.Split(pair, ",")
+		if len(coords) != 2 {
+			return fmt.Errorf("invalid point '%s'", pair)
+		}
+		x, err := strconv.ParseFloat(coords[0], 64)
+		if err != nil {
+			return err
+		}
+		y, err := strconv.ParseFloat(coords[1], 64)
+		if err != nil {
+			return err
+		}
+		*p = append(*p, Point{X: x, Y: y})
+	}
+	return nil
+}
+
+func (p PointList) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	pairs := make([]string, len(p))
+	for i, point := range p {
+		pairs[i] = strconv.FormatFloat(point.X, 'f', -1, 64) + "," + strconv.FormatFloat(point.Y, 'f', -1, 64)
+	}
+	return xml.Attr{Name: name, Value: strings.Join(pairs, " ")}, nil
+}
+
+// Polygon holds the points of a polygon or polyline object, relative to the object's position
+type Polygon struct {
+	Points PointList `xml:"points,attr"`
+}
+
+// worldPolygon returns the vertices of the object's polygon in world coordinates
+func (o *Object) worldPolygon() []Point {
+	points := make([]Point, len(o.Polygon.Points))
+	for i, p := range o.Polygon.Points {
+		points[i] = Point{X: float64(o.X) + p.X, Y: float64(o.Y) + p.Y}
+	}
+	return points
+}
+
+// ObjectShape is the kind of shape of an object
+type ObjectShape string
+
+const (
+	ShapeRectangle ObjectShape = "rectangle"
+	ShapeEllipse   ObjectShape = "ellipse"
+	ShapePoint     ObjectShape = "point"
+	ShapePolygon   ObjectShape = "polygon"
+	ShapePolyline  ObjectShape = "polyline"
+)
+
+// Shape returns the kind of shape of the object. Tile objects are rectangles.
+func (o *Object) Shape() ObjectShape {
+	switch {
+	case o.Polygon != nil:
+		return ShapePolygon
+	case o.Polyline != nil:
+		return ShapePolyline
+	case o.Ellipse != nil:
+		return ShapeEllipse
+	case o.Point != nil:
+		return ShapePoint
+	}
+	return ShapeRectangle
+}
+
+// Bounds returns the bounding rectangle of the object's shape in world coordinates
+func (o *Object) Bounds() image.Rectangle {
+	var points []Point
+	switch {
+	case o.Polygon != nil:
+		points = o.worldPolygon()
+	case o.Polyline != nil:
+		points = make([]Point, len(o.Polyline.Points))
+		for i, p := range o.Polyline.Points {
+			points[i] = Point{X: float64(o.X) + p.X, Y: float64(o.Y) + p.Y}
+		}
+	default:
+		return image.Rect(o.X, o.Y, o.X+o.Width, o.Y+o.Height)
+	}
+	if len(points) == 0 {
+		return image.Rect(o.X, o.Y, o.X, o.Y)
+	}
+
+	min, max := points[0], points[0]
+	for _, p := range points[1:] {
+		min.X, min.Y = math.Min(min.X, p.X), math.Min(min.Y, p.Y)
+		max.X, max.Y = math.Max(max.X, p.X), math.Max(max.Y, p.Y)
+	}
+	return image.Rect(int(math.Floor(min.X)), int(math.Floor(min.Y)), int(math.Ceil(max.X)), int(math.Ceil(max.Y)))
+}
+
+// ContainsPoint reports whether p lies within the object's shape.
+// Points and polylines have no area and never contain a point.
+func (o *Object) ContainsPoint(p Point) bool {
+	switch o.Shape() {
+	case ShapePolygon:
+		// even-odd rule, casting a ray to the right of p
+		polygon := o.worldPolygon()
+		inside := false
+		for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+			a, b := polygon[i], polygon[j]
+			if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+				inside = !inside
+			}
+		}
+		return inside
+	case ShapeEllipse:
+		if o.Width <= 0 || o.Height <= 0 {
+			return false
+		}
+		rx, ry := float64(o.Width)/2, float64(o.Height)/2
+		dx, dy := (p.X-float64(o.X)-rx)/rx, (p.Y-float64(o.Y)-ry)/ry
+		return dx*dx+dy*dy <= 1
+	case ShapeRectangle:
+		return p.X >= float64(o.X) && p.X <= float64(o.X+o.Width) &&
+			p.Y >= float64(o.Y) && p.Y <= float64(o.Y+o.Height)
+	}
+	return false
+}
+
+// overlapsEllipse reports whether r overlaps the ellipse inscribed in the object's rectangle.
+// Scaled so the ellipse becomes the unit circle, the point of r closest to its center decides.
+func overlapsEllipse(r image.Rectangle, o *Object) bool {
+	if o.Width <= 0 || o.Height <= 0 || r.Empty() {
+		return false
+	}
+	rx, ry := float64(o.Width)/2, float64(o.Height)/2
+	cx, cy := float64(o.X)+rx, float64(o.Y)+ry
+	x := math.Max(float64(r.Min.X), math.Min(cx, float64(r.Max.X)))
+	y := math.Max(float64(r.Min.Y), math.Min(cy, float64(r.Max.Y)))
+	dx, dy := (x-cx)/rx, (y-cy)/ry
+	return dx*dx+dy*dy < 1
+}
+
+func rectPolygon(r image.Rectangle) []Point {
+	return []Point{
+		{float64(r.Min.X), float64(r.Min.Y)},
+		{float64(r.Max.X), float64(r.Min.Y)},
+		{float64(r.Max.X), float64(r.Max.Y)},
+		{float64(r.Min.X), float64(r.Max.Y)},
+	}
+}
+
+// ResolveCollision returns the translation that moves subject out of all colliders of the
+// collision groups (see SetCollisionGroups) and whether there was any collision.
+// The minimum translation is found using the separating axis theorem, which only works on convex
+// shapes: concave polygons are resolved as their convex hull, ellipse, point and polyline objects
+// as their bounding boxes. Colliders are resolved one after another, each using the subject
+// moved by the previous translations.
+func (t *TmxMap) ResolveCollision(subject image.Rectangle) (Point, bool) {
+	var total Point
+	collided := false
+	subjectPolygon := rectPolygon(subject)
+	for _, object := range t.collisionObjects() {
+		var collider []Point
+		if object.Polygon != nil {
+			collider = convexHull(object.worldPolygon())
+		} else {
+			collider = rectPolygon(object.Bounds())
+		}
+
+		mtv, ok := separate(subjectPolygon, collider)
+		if !ok {
+			continue
+		}
+		collided = true
+		total.X += mtv.X
+		total.Y += mtv.Y
+		for i := range subjectPolygon {
+			subjectPolygon[i].X += mtv.X
+			subjectPolygon[i].Y += mtv.Y
+		}
+	}
+	return total, collided
+}
+
+// convexHull returns the convex hull of the points in counter-clockwise order, using the monotone chain algorithm
+func convexHull(points []Point) []Point {
+	if len(points) < 3 {
+		return points
+	}
+	sorted := append([]Point(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].X < sorted[j].X || (sorted[i].X == sorted[j].X && sorted[i].Y < sorted[j].Y)
+	})
+	cross := func(o, a, b Point) float64 {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+
+	hull := make([]Point, 0, 2*len(sorted))
+	// lower hull, then upper hull, each dropping points that don't make a left turn
+	for pass := 0; pass < 2; pass++ {
+		start := len(hull)
+		for i := range sorted {
+			p := sorted[i]
+			if pass == 1 {
+				p = sorted[len(sorted)-1-i]
+			}
+			for len(hull) >= start+2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, p)
+		}
+		// the last point is the first one of the other half
+		hull = hull[:len(hull)-1]
+	}
+	return hull
+}
+
+// separate returns the minimum translation moving convex polygon a out of convex polygon b,
+// ok is false if they don't overlap
+func separate(a, b []Point) (Point, bool) {
+	if len(a) < 3 || len(b) < 3 {
+		return Point{}, false
+	}
+
+	minOverlap := math.Inf(1)
+	var axis Point
+	for _, polygon := range [][]Point{a, b} {
+		for i := range polygon {
+			p1, p2 := polygon[i], polygon[(i+1)%len(polygon)]
+			normal := Point{X: p1.Y - p2.Y, Y: p2.X - p1.X}
+			length := math.Hypot(normal.X, normal.Y)
+			if length == 0 {
+				continue
+			}
+			normal.X /= length
+			normal.Y /= length
+
+			minA, maxA := project(a, normal)
+			minB, maxB := project(b, normal)
+			overlap := math.Min(maxA, maxB) - math.Max(minA, minB)
+			if overlap <= 0 {
+				return Point{}, false
+			}
+			if overlap < minOverlap {
+				minOverlap = overlap
+				axis = normal
+			}
+		}
+	}
+
+	// push a away from b
+	ca, cb := centroid(a), centroid(b)
+	if (ca.X-cb.X)*axis.X+(ca.Y-cb.Y)*axis.Y < 0 {
+		axis.X, axis.Y = -axis.X, -axis.Y
+	}
+	return Point{X: axis.X * minOverlap, Y: axis.Y * minOverlap}, true
+}
+
+func project(polygon []Point, axis Point) (float64, float64) {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, p := range polygon {
+		d := p.X*axis.X + p.Y*axis.Y
+		min = math.Min(min, d)
+		max = math.Max(max, d)
+	}
+	return min, max
+}
+
+func centroid(polygon []Point) Point {
+	var c Point
+	for _, p := range polygon {
+		c.X += p.X
+		c.Y += p.Y
+	}
+	c.X /= float64(len(polygon))
+	c.Y /= float64(len(polygon))
+	return c
+}
+
+// colliderGrid is a uniform grid over collider rectangles for fast overlap queries
+type colliderGrid struct {
+	cellSize int
+	cells    map[image.Point][]int
+}
+
+func newColliderGrid(rects []image.Rectangle, cellSize int) *colliderGrid {
+	if cellSize <= 0 {
+		cellSize = 64
+	}
+	g := &colliderGrid{
+		cellSize: cellSize,
+		cells:    make(map[image.Point][]int),
+	}
+	for i, r := range rects {
+		min, max := g.cellRange(r)
+		for y := min.Y; y <= max.Y; y++ {
+			for x := min.X; x <= max.X; x++ {
+				cell := image.Pt(x, y)
+				g.cells[cell] = append(g.cells[cell], i)
+			}
+		}
+	}
+	return g
+}
+
+func (g *colliderGrid) cellRange(r image.Rectangle) (image.Point, image.Point) {
+	return image.Pt(floorDiv(r.Min.X, g.cellSize), floorDiv(r.Min.Y, g.cellSize)),
+		image.Pt(floorDiv(r.Max.X, g.cellSize), floorDiv(r.Max.Y, g.cellSize))
+}
+
+// any reports whether fn returns true for any collider sharing a grid cell with area
+func (g *colliderGrid) any(area image.Rectangle, fn func(i int) bool) bool {
+	min, max := g.cellRange(area)
+	for y := min.Y; y <= max.Y; y++ {
+		for x := min.X; x <= max.X; x++ {
+			for _, i := range g.cells[image.Pt(x, y)] {
+				if fn(i) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// defaultCollisionGroup is the object group used for collisions unless SetCollisionGroups is called
+const defaultCollisionGroup = "collisionmap"
+
+// SetCollisionGroups sets the object groups, matched by name or class, whose objects the collision
+// methods test against. Calling it without names restores the default "collisionmap" group.
+func (t *TmxMap) SetCollisionGroups(names ...string) {
+	t.collisionGroups = names
+	t.InvalidateCollisionIndex()
+}
+
+// collisionGroupList returns the object groups configured as collision sources in document order
+func (t *TmxMap) collisionGroupList() []*ObjectGroup {
+	names := t.collisionGroups
+	if len(names) == 0 {
+		names = []string{defaultCollisionGroup}
+	}
+
+	var groups []*ObjectGroup
+	for _, group := range t.ObjectGroups {
+		for _, name := range names {
+			if group.Name == name || (group.Class != "" && group.Class == name) {
+				groups = append(groups, group)
+				break
+			}
+		}
+	}
+	return groups
+}
+
+// collisionObjects returns the objects of all collision groups
+func (t *TmxMap) collisionObjects() []*Object {
+	var objects []*Object
+	for _, group := range t.collisionGroupList() {
+		objects = append(objects, group.Objects...)
+	}
+	return objects
+}
+
+// collisionIndex returns the spatial index over the objects of the collision groups along with
+// the indexed objects, building it if the groups' objects changed since it was built
+func (t *TmxMap) collisionIndex() (*colliderGrid, []*Object) {
+	groups := t.collisionGroupList()
+	if t.colliders == nil || t.collidersStale(groups) {
+		t.collidersOf = make([][]*Object, 0, len(groups))
+		t.colliderObjects = nil
+		for _, group := range groups {
+			t.collidersOf = append(t.collidersOf, group.Objects)
+			t.colliderObjects = append(t.colliderObjects, group.Objects...)
+		}
+
+		rects := make([]image.Rectangle, 0, len(t.colliderObjects))
+		for _, object := range t.colliderObjects {
+			rects = append(rects, object.Bounds())
+		}
+		t.colliders = newColliderGrid(rects, 4*t.TileWidth)
+	}
+	return t.colliders, t.colliderObjects
+}
+
+// collidersStale reports whether the object lists of groups differ from the ones last indexed
+func (t *TmxMap) collidersStale(groups []*ObjectGroup) bool {
+	if len(groups) != len(t.collidersOf) {
+		return true
+	}
+	for i, group := range groups {
+		indexed := t.collidersOf[i]
+		if len(indexed) != len(group.Objects) || (len(indexed) > 0 && &indexed[0] != &group.Objects[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidateCollisionIndex drops the spatial index used by CheckColision.
+// Adding or removing objects is detected, but moving or resizing them requires calling this.
+func (t *TmxMap) InvalidateCollisionIndex() {
+	t.colliders = nil
+	t.collidersOf = nil
+	t.colliderObjects = nil
+}
+
+// CheckColisionBatch checks every subject for overlaps with the objects of the collision groups
+// and returns the result per subject. It uses the same spatial index and shape tests as CheckColision,
+// so the results match calling it per subject, while the index is only looked up once.
+func (t *TmxMap) CheckColisionBatch(subjects []image.Rectangle) []bool {
+	results := make([]bool, len(subjects))
+	index, objects := t.collisionIndex()
+	for i, subject := range subjects {
+		results[i] = index.any(subject, func(j int) bool {
+			return overlapsObject(subject, objects[j])
+		})
+	}
+	return results
+}
+
+// PixelCollisionAt reports whether the pixel of the named layer at the map position p is solid,
+// i.e. the tile drawn there has an alpha value of at least alphaThreshold at that pixel.
+// Flips and animation frames are taken into account, replaced tile images are not.
+// Tiles without a source image count as solid.
+func (t *TmxMap) PixelCollisionAt(layerName string, p image.Point, alphaThreshold uint8) bool {
+	layer := t.GetLayerByName(layerName)
+	if layer == nil {
+		return false
+	}
+	tile, local := t.tileLocalPoint(layer, p)
+	if tile == nil {
+		return false
+	}
+	tileset := tile.Tileset
+	if tileset.TilesetImage == nil {
+		return true
+	}
+
+	id := int(tile.InternalTileID)
+	if def := tileset.TileDefinition(id); def != nil && len(def.Animation) > 0 {
+		id = frameAt(def.Animation, t.animationTime)
+	}
+	src, ok := tileset.TileRect(id)
+	if !ok {
+		return false
+	}
+
+	pixel := image.Pt(src.Min.X+int(math.Floor(local.X)), src.Min.Y+int(math.Floor(local.Y)))
+	if !pixel.In(src) {
+		return false
+	}
+
+	_, _, _, a := tileset.TilesetImage.At(pixel.X, pixel.Y).RGBA()
+	return uint8(a>>8) >= alphaThreshold
+}
+
+// TileCollisionAt reports whether the map position x, y lies within one of the collision shapes
+// the tileset defines for the tile placed there, on any tile layer. Flips are taken into account.
+func (t *TmxMap) TileCollisionAt(x, y int) bool {
+	for _, layer := range t.Layers {
+		tile, local := t.tileLocalPoint(layer, image.Pt(x, y))
+		if tile == nil {
+			continue
+		}
+		def := tile.Definition()
+		if def == nil || def.ObjectGroup == nil {
+			continue
+		}
+		for _, shape := range def.ObjectGroup.Objects {
+			if shape.ContainsPoint(local) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tileLocalPoint returns the tile of the layer in the cell under the map position p, along with
+// the center of the pixel at p in the coordinates of the unflipped tile. The tile is nil if the cell is empty.
+func (t *TmxMap) tileLocalPoint(layer *Layer, p image.Point) (*Tile, Point) {
+	if t.TileWidth <= 0 || t.TileHeight <= 0 {
+		return nil, Point{}
+	}
+	cellX, cellY := floorDiv(p.X, t.TileWidth), floorDiv(p.Y, t.TileHeight)
+	tile := layer.GetTileAt(cellX, cellY)
+	if tile == nil || tile.Tileset == nil {
+		return nil, Point{}
+	}
+
+	// position within the drawn tile, which is aligned to the bottom left of its cell
+	width, height := tile.Tileset.tileSize(int(tile.InternalTileID))
+	geoM := flipGeoM(TileFlags(tile.encodeGID()), float64(width), float64(height))
+	geoM.Invert()
+	x, y := geoM.Apply(
+		float64(p.X-cellX*t.TileWidth)+0.5,
+		float64(p.Y-(cellY+1)*t.TileHeight+height)+0.5,
+	)
+	return tile, Point{X: x, Y: y}
+}
@@ -0,0 +1,327 @@
+package ebitmx
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestResolveCollisionTriangle(t *testing.T) {
+	// right triangle with the right angle at its top left corner
+	gameMap := loadTestMap(t, testTMX(8, 8, ` <objectgroup id="1" name="collisionmap">
+  <object id="1" x="32" y="32">
+   <polygon points="0,0 32,0 0,32"/>
+  </object>
+ </objectgroup>
+`))
+
+	tests := []struct {
+		name    string
+		subject image.Rectangle
+		want    Point
+		collide bool
+	}{
+		{"from above", image.Rect(36, 28, 44, 36), Point{X: 0, Y: -4}, true},
+		{"from the left", image.Rect(28, 40, 36, 48), Point{X: -4, Y: 0}, true},
+		{"across the hypotenuse", image.Rect(46, 46, 54, 54), Point{X: 2, Y: 2}, true},
+		{"clear of the hypotenuse", image.Rect(50, 50, 58, 58), Point{}, false},
+	}
+	for _, test := range tests {
+		got, collided := gameMap.ResolveCollision(test.subject)
+		if collided != test.collide || math.Abs(got.X-test.want.X) > 1e-9 || math.Abs(got.Y-test.want.Y) > 1e-9 {
+			t.Errorf("%s: ResolveCollision = %v, %t, want %v, %t", test.name, got, collided, test.want, test.collide)
+		}
+	}
+}
+
+func TestResolveCollisionConcave(t *testing.T) {
+	// a square with a triangular notch cut into its bottom edge, its convex hull is the square
+	gameMap := loadTestMap(t, testTMX(8, 8, ` <objectgroup id="1" name="collisionmap">
+  <object id="1" x="32" y="32">
+   <polygon points="0,0 32,0 32,32 16,8 0,32"/>
+  </object>
+ </objectgroup>
+`))
+
+	// the subject only reaches into the notch, but is pushed out of the hull's bottom edge
+	got, collided := gameMap.ResolveCollision(image.Rect(40, 58, 56, 70))
+	if !collided || math.Abs(got.X) > 1e-9 || math.Abs(got.Y-6) > 1e-9 {
+		t.Errorf("ResolveCollision = %v, %t, want %v, true", got, collided, Point{Y: 6})
+	}
+
+	hull := convexHull([]Point{{0, 0}, {32, 0}, {32, 32}, {16, 8}, {0, 32}})
+	if len(hull) != 4 {
+		t.Errorf("convex hull %v, want the 4 corners of the square", hull)
+	}
+}
+
+func TestCheckColisionBatch(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(8, 8, ` <objectgroup id="1" name="collisionmap">
+  <object id="1" x="0" y="0" width="16" height="16"/>
+  <object id="2" x="32" y="32">
+   <polygon points="0,0 32,0 0,32"/>
+  </object>
+ </objectgroup>
+`))
+
+	subjects := []image.Rectangle{
+		image.Rect(8, 8, 24, 24),
+		image.Rect(36, 36, 44, 44),
+		// within the triangle's bounds but beyond its hypotenuse
+		image.Rect(54, 54, 62, 62),
+		image.Rect(100, 100, 108, 108),
+	}
+	results := gameMap.CheckColisionBatch(subjects)
+	for i, subject := range subjects {
+		if want := gameMap.CheckColision(subject); results[i] != want {
+			t.Errorf("subject %v: batch result %t, CheckColision %t", subject, results[i], want)
+		}
+	}
+	if want := []bool{true, true, false, false}; !equalBools(results, want) {
+		t.Errorf("batch results %v, want %v", results, want)
+	}
+}
+
+func equalBools(a, b []bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// collidersMap returns a map of 64x64 tiles with a 16x16 collider in every tile
+func collidersMap(n int) *TmxMap {
+	group := &ObjectGroup{Name: defaultCollisionGroup}
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			group.Objects = append(group.Objects, &Object{ID: y*n + x + 1, X: x*64 + 24, Y: y*64 + 24, Width: 16, Height: 16})
+		}
+	}
+	return &TmxMap{Width: n, Height: n, TileWidth: 64, TileHeight: 64, ObjectGroups: []*ObjectGroup{group}}
+}
+
+// randomSubjects returns count 8x8 rectangles spread over the map
+func randomSubjects(gameMap *TmxMap, count int) []image.Rectangle {
+	rnd := rand.New(rand.NewSource(1))
+	subjects := make([]image.Rectangle, count)
+	for i := range subjects {
+		x, y := rnd.Intn(gameMap.Width*gameMap.TileWidth), rnd.Intn(gameMap.Height*gameMap.TileHeight)
+		subjects[i] = image.Rect(x, y, x+8, y+8)
+	}
+	return subjects
+}
+
+// quietLogs raises the log level for benchmarks, collisions are logged at debug level
+func quietLogs(b *testing.B) {
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	b.Cleanup(func() { zerolog.SetGlobalLevel(level) })
+}
+
+func BenchmarkCheckColisionBatch(b *testing.B) {
+	quietLogs(b)
+	gameMap := collidersMap(32)
+	subjects := randomSubjects(gameMap, 256)
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			gameMap.CheckColisionBatch(subjects)
+		}
+	})
+	b.Run("single", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, subject := range subjects {
+				gameMap.CheckColision(subject)
+			}
+		}
+	})
+}
+
+func TestCheckColisionPoint(t *testing.T) {
+	gameMap := collidersMap(8)
+	for _, test := range []struct {
+		p    image.Point
+		want bool
+	}{
+		{image.Pt(24, 24), true},
+		{image.Pt(40, 40), true},
+		{image.Pt(64+30, 128+30), true},
+		{image.Pt(10, 10), false},
+		{image.Pt(41, 30), false},
+		{image.Pt(1000, 1000), false},
+	} {
+		if got := gameMap.CheckColisionPoint(test.p); got != test.want {
+			t.Errorf("CheckColisionPoint(%v) = %t, want %t", test.p, got, test.want)
+		}
+	}
+	if gameMap.colliders == nil {
+		t.Error("the collision index wasn't kept")
+	}
+}
+
+func BenchmarkCheckColision(b *testing.B) {
+	quietLogs(b)
+	gameMap := collidersMap(64)
+	subjects := randomSubjects(gameMap, 256)
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			gameMap.CheckColision(subjects[i%len(subjects)])
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			gameMap.CheckColisionInGroup(subjects[i%len(subjects)], defaultCollisionGroup)
+		}
+	})
+	b.Run("point", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			gameMap.CheckColisionPoint(subjects[i%len(subjects)].Min)
+		}
+	})
+}
+
+func TestTileCollisionAt(t *testing.T) {
+	fsys := newTestFS(testTMX(3, 1, csvLayer(1, "ground", 3, 1, 1, 1|FLIPPED_HORIZONTALLY_FLAG, 2)))
+	fsys["tiles.tsx"].Data = []byte(collisionTSX)
+	gameMap := loadTestMapFS(t, fsys)
+
+	def := gameMap.Tilesets[0].TileDefinition(0)
+	if def == nil || def.ObjectGroup == nil || len(def.ObjectGroup.Objects) != 1 || def.ObjectGroup.Objects[0].Width != 4 {
+		t.Fatalf("collision rectangle of tile 0 wasn't parsed: %+v", def)
+	}
+
+	tests := []struct {
+		p    image.Point
+		want bool
+	}{
+		{image.Pt(0, 0), true},
+		{image.Pt(3, 15), true},
+		{image.Pt(4, 8), false},
+		// the rectangle of the flipped tile is at its right edge
+		{image.Pt(17, 8), false},
+		{image.Pt(28, 8), true},
+		// tile 1 has no collision shapes
+		{image.Pt(34, 8), false},
+		{image.Pt(-2, 8), false},
+	}
+	for _, test := range tests {
+		if got := gameMap.TileCollisionAt(test.p.X, test.p.Y); got != test.want {
+			t.Errorf("TileCollisionAt(%d, %d) = %t, want %t", test.p.X, test.p.Y, got, test.want)
+		}
+	}
+}
+
+func TestPixelCollisionAt(t *testing.T) {
+	// tile 0 has a transparent 8x8 top left corner
+	img := tilesetImage(testTileColumns, testTileCount/testTileColumns, testTileSize, testTileSize)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.SetRGBA(x, y, color.RGBA{})
+		}
+	}
+	fsys := newTestFS(testTMX(2, 1, csvLayer(1, "ground", 2, 1, 1, 1|FLIPPED_HORIZONTALLY_FLAG)))
+	fsys["tiles.png"].Data = encodePNG(img)
+	gameMap := loadTestMapFS(t, fsys)
+
+	tests := []struct {
+		p    image.Point
+		want bool
+	}{
+		{image.Pt(2, 2), false},
+		{image.Pt(7, 7), false},
+		{image.Pt(8, 2), true},
+		{image.Pt(12, 12), true},
+		// the flipped tile has its transparent corner at the top right
+		{image.Pt(18, 2), true},
+		{image.Pt(30, 2), false},
+		{image.Pt(40, 2), false},
+	}
+	for _, test := range tests {
+		if got := gameMap.PixelCollisionAt("ground", test.p, 128); got != test.want {
+			t.Errorf("PixelCollisionAt(%v) = %t, want %t", test.p, got, test.want)
+		}
+	}
+}
+
+func TestSetCollisionGroups(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(8, 8, ` <objectgroup id="1" name="collisionmap">
+  <object id="1" x="0" y="0" width="16" height="16"/>
+ </objectgroup>
+ <objectgroup id="2" name="walls">
+  <object id="2" x="32" y="0" width="16" height="16"/>
+ </objectgroup>
+ <objectgroup id="3" name="lava" class="hazard">
+  <object id="3" x="64" y="0" width="16" height="16"/>
+ </objectgroup>
+`))
+	defaultGroup, wall, lava := image.Rect(4, 4, 8, 8), image.Rect(36, 4, 40, 8), image.Rect(68, 4, 72, 8)
+
+	if !gameMap.CheckColision(defaultGroup) || gameMap.CheckColision(wall) {
+		t.Error("only the collisionmap group should collide by default")
+	}
+	gameMap.SetCollisionGroups("walls", "hazard")
+	if !gameMap.CheckColision(wall) || !gameMap.CheckColision(lava) {
+		t.Error("subjects overlapping either collision group didn't collide")
+	}
+	if gameMap.CheckColision(defaultGroup) {
+		t.Error("the collisionmap group still collides")
+	}
+	gameMap.SetCollisionGroups()
+	if !gameMap.CheckColision(defaultGroup) || gameMap.CheckColision(lava) {
+		t.Error("resetting the collision groups didn't restore the default")
+	}
+}
+
+func TestCollisionWithoutGroup(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(4, 4, ` <objectgroup id="1" name="solid">
+  <object id="1" x="0" y="0" width="16" height="16"/>
+ </objectgroup>
+`))
+	subject := image.Rect(4, 4, 12, 12)
+
+	if gameMap.CheckColision(subject) || gameMap.CheckColisionPoint(image.Pt(8, 8)) {
+		t.Error("map without a collisionmap group collided")
+	}
+	if got := gameMap.CheckColisionBatch([]image.Rectangle{subject}); got[0] {
+		t.Error("batch query on a map without a collisionmap group collided")
+	}
+	if !gameMap.CheckColisionInGroup(subject, "solid") {
+		t.Error("subject didn't collide with the custom group")
+	}
+	if gameMap.CheckColisionInGroup(subject, "missing") {
+		t.Error("subject collided with a missing group")
+	}
+}
+
+func TestOverlapsObject(t *testing.T) {
+	object := &Object{X: 32, Y: 32, Width: 16, Height: 16}
+	tests := []struct {
+		name    string
+		subject image.Rectangle
+		want    bool
+	}{
+		{"touching the left edge", image.Rect(16, 32, 32, 48), false},
+		{"touching the bottom edge", image.Rect(32, 48, 48, 64), false},
+		{"touching a corner", image.Rect(48, 48, 56, 56), false},
+		{"overlapping by a pixel", image.Rect(16, 32, 33, 48), true},
+		{"fully inside", image.Rect(36, 36, 44, 44), true},
+		{"fully covering", image.Rect(0, 0, 100, 100), true},
+		{"separate", image.Rect(0, 0, 8, 8), false},
+		{"separate on one axis", image.Rect(36, 80, 44, 90), false},
+	}
+	for _, test := range tests {
+		if got := overlapsObject(test.subject, object); got != test.want {
+			t.Errorf("%s: overlapsObject(%v) = %t, want %t", test.name, test.subject, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package ebitmx
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+)
+
+// DebugGridOption configures DrawDebugGrid
+type DebugGridOption func(*debugGridOptions)
+
+type debugGridOptions struct {
+	color      color.Color
+	labelFace  font.Face
+	labelColor color.Color
+}
+
+// WithGridColor sets the color of the grid lines
+func WithGridColor(c color.Color) DebugGridOption {
+	return func(o *debugGridOptions) {
+		o.color = c
+	}
+}
+
+// WithCoordinateLabels draws the tile coordinates into every visible cell using face
+func WithCoordinateLabels(face font.Face, c color.Color) DebugGridOption {
+	return func(o *debugGridOptions) {
+		o.labelFace = face
+		o.labelColor = c
+	}
+}
+
+// DrawDebugGrid draws the tile grid of the camera view onto dst, scaled by scale.
+// Only the visible cells are drawn.
+func (t *TmxMap) DrawDebugGrid(dst *ebiten.Image, scale float64, opts ...DebugGridOption) {
+	o := debugGridOptions{color: color.RGBA{R: 0xff, A: 0xff}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cam := t.UpdateScaledCam(scale)
+	visible := t.VisibleTileRange(scale)
+	cellWidth := float64(t.TileWidth) * scale
+	cellHeight := float64(t.TileHeight) * scale
+
+	for y := visible.Min.Y; y <= visible.Max.Y; y++ {
+		for x := visible.Min.X; x <= visible.Max.X; x++ {
+			screenX := float64(x*t.TileWidth-cam.Min.X) * scale
+			screenY := float64(y*t.TileHeight-cam.Min.Y) * scale
+
+			ebitenutil.DrawLine(dst, screenX, screenY, screenX+cellWidth, screenY, o.color)
+			ebitenutil.DrawLine(dst, screenX, screenY, screenX, screenY+cellHeight, o.color)
+
+			if o.labelFace != nil {
+				ascent := o.labelFace.Metrics().Ascent.Ceil()
+				text.Draw(dst, fmt.Sprintf("%d,%d", x, y), o.labelFace, int(screenX)+2, int(screenY)+ascent+1, o.labelColor)
+			}
+		}
+	}
+}
+
+// defaultOutlineColor is the default object color of Tiled
+var defaultOutlineColor = color.NRGBA{R: 0xa0, G: 0xa0, B: 0xa4, A: 0xff}
+
+// ellipseSegments is the number of lines approximating ellipse outlines
+const ellipseSegments = 32
+
+// DebugRenderOption configures ObjectGroup.DebugRender
+type DebugRenderOption func(*debugRenderOptions)
+
+type debugRenderOptions struct {
+	color color.Color
+}
+
+// WithOutlineColor sets the color of the object outlines, overriding the group's color
+func WithOutlineColor(c color.Color) DebugRenderOption {
+	return func(o *debugRenderOptions) {
+		o.color = c
+	}
+}
+
+// outline returns the outline of the object's shape relative to its position, before rotation.
+// closed reports whether the last point connects back to the first.
+func (o *Object) outline() (points []Point, closed bool) {
+	switch o.Shape() {
+	case ShapePolygon:
+		return o.Polygon.Points, true
+	case ShapePolyline:
+		return o.Polyline.Points, false
+	case ShapeEllipse:
+		rx, ry := float64(o.Width)/2, float64(o.Height)/2
+		points = make([]Point, ellipseSegments)
+		for i := range points {
+			a := 2 * math.Pi * float64(i) / ellipseSegments
+			points[i] = Point{X: rx + rx*math.Cos(a), Y: ry + ry*math.Sin(a)}
+		}
+		return points, true
+	case ShapePoint:
+		// a small cross, drawn as two separate lines
+		return []Point{{X: -3, Y: 0}, {X: 3, Y: 0}, {X: 0, Y: -3}, {X: 0, Y: 3}}, false
+	}
+	return rectPolygon(image.Rect(0, 0, o.Width, o.Height)), true
+}
+
+// drawOutline draws the outline of the object onto dst in map pixels, rotated around its origin
+func (o *Object) drawOutline(dst *ebiten.Image, clr color.Color) {
+	var g ebiten.GeoM
+	g.Rotate(o.Rotation * math.Pi / 180)
+	g.Translate(float64(o.X), float64(o.Y))
+	line := func(a, b Point) {
+		ax, ay := g.Apply(a.X, a.Y)
+		bx, by := g.Apply(b.X, b.Y)
+		ebitenutil.DrawLine(dst, ax, ay, bx, by, clr)
+	}
+
+	points, closed := o.outline()
+	if o.Shape() == ShapePoint {
+		line(points[0], points[1])
+		line(points[2], points[3])
+		return
+	}
+	for i := 0; i+1 < len(points); i++ {
+		line(points[i], points[i+1])
+	}
+	if closed && len(points) > 2 {
+		line(points[len(points)-1], points[0])
+	}
+}
+
+// DumpLayersPNG renders every tile layer at full map size and writes it to dir/<layer name>.png.
+// Layer names are sanitized into file names, duplicates get a numeric suffix.
+// Reading back the images requires the game loop to be running.
+func (t *TmxMap) DumpLayersPNG(dir string) error {
+	used := make(map[string]bool)
+	for _, layer := range t.Layers {
+		layer.Render(t, 1, false)
+
+		base := sanitizeFileName(layer.Name)
+		name := base
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		used[name] = true
+
+		if err := writePNG(filepath.Join(dir, name+".png"), layer.Rendered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func sanitizeFileName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	if sanitized == "" {
+		return "layer"
+	}
+	return sanitized
+}
@@ -0,0 +1,108 @@
+package ebitmx
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"golang.org/x/image/font/basicfont"
+)
+
+func TestDrawDebugGridLabels(t *testing.T) {
+	gameMap := &TmxMap{Width: 10, Height: 10, TileWidth: 16, TileHeight: 16}
+	gameMap.CameraBounds = image.Rect(0, 0, 32, 32)
+	gameMap.CameraPosition = image.Pt(48, 48)
+
+	green := color.RGBA{G: 0xff, A: 0xff}
+	dst := ebiten.NewImage(96, 96)
+	gameMap.DrawDebugGrid(dst, 1, WithGridColor(color.Transparent), WithCoordinateLabels(basicfont.Face7x13, green))
+
+	// the visible cells 2..3 are drawn at 0..31, each gets a label below its top left corner
+	for _, cell := range []image.Point{{0, 0}, {16, 0}, {0, 16}, {16, 16}} {
+		if !containsColor(dst, image.Rect(cell.X+2, cell.Y+2, cell.X+16, cell.Y+16), green) {
+			t.Errorf("no label drawn for the cell at %v", cell)
+		}
+	}
+	// labels of further cells would start at 32
+	if containsColor(dst, image.Rect(0, 32, 96, 96), green) {
+		t.Error("labels drawn below the visible range")
+	}
+	if containsColor(dst, image.Rect(40, 0, 96, 32), green) {
+		t.Error("labels drawn right of the visible range")
+	}
+}
+
+// containsColor reports whether any pixel of img within r has color c
+func containsColor(img *ebiten.Image, r image.Rectangle, c color.RGBA) bool {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if pixelAt(img, x, y) == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestDebugRenderRotatedObject(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(8, 8, ` <objectgroup id="1" name="objects">
+  <object id="1" x="64" y="32" width="32" height="8" rotation="90"/>
+ </objectgroup>
+`))
+	gameMap.CameraBounds = image.Rect(0, 0, 128, 128)
+	gameMap.CameraPosition = image.Pt(64, 64)
+	group := gameMap.ObjectGroups[0]
+	red := color.RGBA{R: 0xff, A: 0xff}
+	group.DebugRender(gameMap, 1, WithOutlineColor(red))
+
+	// rotated clockwise around its top left corner the object covers 56,32 to 64,64
+	if !containsColor(group.Rendered, image.Rect(54, 30, 66, 66), red) {
+		t.Error("no outline drawn within the rotated object's region")
+	}
+	for _, r := range []image.Rectangle{image.Rect(67, 30, 100, 42), image.Rect(0, 0, 53, 128), image.Rect(54, 67, 128, 128)} {
+		if containsColor(group.Rendered, r, red) {
+			t.Errorf("outline drawn in %v outside of the rotated object's region", r)
+		}
+	}
+	// the outline doesn't fill the object
+	if containsColor(group.Rendered, image.Rect(58, 35, 62, 61), red) {
+		t.Error("rotated object is filled")
+	}
+}
+
+func TestDumpLayersPNG(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(2, 1, csvLayer(1, "ground floor", 2, 1, 1, 2)+csvLayer(2, "ground/floor", 2, 1, 0, 4)))
+	dir := t.TempDir()
+	if err := gameMap.DumpLayersPNG(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("dumped %d files, want 2", len(entries))
+	}
+	for name, want := range map[string]color.RGBA{"ground_floor.png": tileColor(1), "ground_floor_2.png": tileColor(3)} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s isn't a valid png: %s", name, err)
+		}
+		if img.Bounds() != image.Rect(0, 0, 32, 16) {
+			t.Errorf("%s has bounds %v, want the map size", name, img.Bounds())
+		}
+		if got := color.RGBAModel.Convert(img.At(24, 8)); got != want {
+			t.Errorf("%s has color %v at 24,8, want %v", name, got, want)
+		}
+	}
+}
@@ -3,17 +3,19 @@ package ebitmx
 // https://www.onlinetool.io/xmltogo/
 
 import (
-	"encoding/base64"
+	"encoding/binary"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"image"
-	"io/ioutil"
+	"image/color"
+	"io/fs"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/rs/zerolog/log"
 )
 
@@ -24,7 +26,16 @@ const (
 	Orthogonal Orientation = "orthogonal"
 	Isometric              = "isometric"
 	Staggered              = "staggered"
-	hexagonal              = "hexagonal"
+	Hexagonal              = "hexagonal"
+)
+
+// Stagger axes and indices of staggered and hexagonal maps
+const (
+	StaggerAxisX = "x"
+	StaggerAxisY = "y"
+
+	StaggerIndexOdd  = "odd"
+	StaggerIndexEven = "even"
 )
 
 type RenderOrder string
@@ -51,92 +62,346 @@ const (
 	BottomRight                 = "bottomright"
 )
 
+// Visibility is the visible attribute of layers, object groups and objects.
+// Tiled only writes it for hidden elements, so elements are visible unless it is present and 0.
+type Visibility bool
+
+func (v Visibility) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	if v {
+		return xml.Attr{}, nil
+	}
+	return xml.Attr{Name: name, Value: "0"}, nil
+}
+
 type TSXFile struct {
-	XMLName      xml.Name `xml:"tileset"`
-	Text         string   `xml:",chardata"`
-	Version      string   `xml:"version,attr"`
-	TiledVersion string   `xml:"tiledversion,attr"`
-	Name         string   `xml:"name,attr"`
-	TileWidth    int      `xml:"tilewidth,attr"`
-	TileHeight   int      `xml:"tileheight,attr"`
-	TileCount    int      `xml:"tilecount,attr"`
-	Columns      int      `xml:"columns,attr"`
-	Image        struct {
-		Text   string `xml:",chardata"`
-		Source string `xml:"source,attr"`
-		Width  int    `xml:"width,attr"`
-		Height int    `xml:"height,attr"`
-	} `xml:"image"`
+	XMLName      xml.Name       `xml:"tileset"`
+	Version      string         `xml:"version,attr,omitempty"`
+	TiledVersion string         `xml:"tiledversion,attr"`
+	Name         string         `xml:"name,attr,omitempty"`
+	TileWidth    int            `xml:"tilewidth,attr,omitempty"`
+	TileHeight   int            `xml:"tileheight,attr,omitempty"`
+	Spacing      int            `xml:"spacing,attr,omitempty"`
+	Margin       int            `xml:"margin,attr,omitempty"`
+	TileCount    int            `xml:"tilecount,attr,omitempty"`
+	Columns      int            `xml:"columns,attr,omitempty"`
+	Image        ImageSource    `xml:"image"`
+	Grid         *Grid          `xml:"grid"`
+	Properties   Properties     `xml:"properties"`
+	Tiles        []*TilesetTile `xml:"tile"`
+}
+
+// Grid describes the grid of a tileset's tiles. Tiled uses it to show the terrain and collision
+// overlays of isometric tilesets, tiles are placed on the map grid regardless of it.
+type Grid struct {
+	Orientation Orientation `xml:"orientation,attr"`
+	Width       int         `xml:"width,attr"`
+	Height      int         `xml:"height,attr"`
+}
+
+// TilesetTile holds the data a tileset defines for an individual tile
+type TilesetTile struct {
+	ID         int        `xml:"id,attr"`
+	Type       string     `xml:"type,attr,omitempty"`
+	Properties Properties `xml:"properties"`
+	Animation  []Frame    `xml:"animation>frame"`
+	// ObjectGroup holds the collision shapes of the tile
+	ObjectGroup *ObjectGroup `xml:"objectgroup"`
+	// Image is the image of the tile in image collection tilesets
+	Image *ImageSource `xml:"image"`
 }
 
 type Tileset struct {
-	Text               string          `xml:",chardata"`
-	FirstGid           uint32          `xml:"firstgid,attr"`
-	Source             string          `xml:"source,attr"`
-	Name               string          `xml:"name,attr"`
-	TileWidth          int             `xml:"tilewidth,attr"`
-	TileHeight         int             `xml:"tileheight,attr"`
-	Spacing            int             `xml:"spacing,attr"`
-	Margin             int             `xml:"margin,attr"`
-	TileCount          int             `xml:"tilecount,attr"`
-	Columns            int             `xml:"colums,attr"`
-	Objectalignment    ObjectAlignment `xml:"objectalignment,attr"`
-	TilesetEbitenImage *ebiten.Image
-	TilesetImage       image.Image
-	Version            string `xml:"version,attr"`
-	Tiledversion       string `xml:"tiledversion,attr"`
-	Tiles              map[int]*ebiten.Image
+	FirstGid           uint32                `xml:"firstgid,attr"`
+	Source             string                `xml:"source,attr,omitempty"`
+	Name               string                `xml:"name,attr,omitempty"`
+	TileWidth          int                   `xml:"tilewidth,attr,omitempty"`
+	TileHeight         int                   `xml:"tileheight,attr,omitempty"`
+	Spacing            int                   `xml:"spacing,attr,omitempty"`
+	Margin             int                   `xml:"margin,attr,omitempty"`
+	TileCount          int                   `xml:"tilecount,attr,omitempty"`
+	Columns            int                   `xml:"columns,attr,omitempty"`
+	Objectalignment    ObjectAlignment       `xml:"objectalignment,attr,omitempty"`
+	TilesetEbitenImage *ebiten.Image         `xml:"-"`
+	TilesetImage       image.Image           `xml:"-"`
+	Version            string                `xml:"version,attr,omitempty"`
+	Tiledversion       string                `xml:"tiledversion,attr,omitempty"`
+	Tiles              map[int]*ebiten.Image `xml:"-"`
+	Grid               *Grid                 `xml:"grid"`
+	Properties         Properties            `xml:"properties"`
+	Image              *ImageSource          `xml:"image"`
+	TileDefinitions    []*TilesetTile        `xml:"tile"`
+	tileDefinitionByID map[int]*TilesetTile
+	imageDecodeTime    time.Duration
+	overrides          map[int]*ebiten.Image
+	sourceResolver     func(string) string
+	fsys               fs.FS
+	// maxDecompressedSize is the map's WithMaxDecompressedSize, 0 for tilesets loaded on their own
+	maxDecompressedSize int64
+}
+
+// describe returns how to refer to the tileset in messages: its quoted source, or for inline
+// tilesets its quoted name or, lacking that, its index in the map
+func (t *Tileset) describe(index int) string {
+	switch {
+	case t.Source != "":
+		return "'" + t.Source + "'"
+	case t.Name != "":
+		return "'" + t.Name + "'"
+	}
+	return fmt.Sprintf("#%d", index)
+}
+
+// decompressLimit returns the size embedded tileset images may inflate to
+func (t *Tileset) decompressLimit() int64 {
+	if t.maxDecompressedSize == 0 {
+		return defaultMaxDecompressedSize
+	}
+	return t.maxDecompressedSize
+}
+
+// OverrideTileImage replaces the image drawn for the given tile, e.g. to swap a closed door for an open one.
+// Cached layer renders need to be invalidated to show the change.
+func (t *Tileset) OverrideTileImage(internalID int, img *ebiten.Image) {
+	if t.overrides == nil {
+		t.overrides = make(map[int]*ebiten.Image)
+	}
+	t.overrides[internalID] = img
+}
+
+// ClearTileOverride restores the original image of a tile replaced by OverrideTileImage
+func (t *Tileset) ClearTileOverride(internalID int) {
+	delete(t.overrides, internalID)
+}
+
+// TileRect returns the rectangle of the given tile within the tileset image, honoring margin and spacing.
+// ok is false for ids outside of the tileset and for image collection tilesets.
+func (t *Tileset) TileRect(internalID int) (image.Rectangle, bool) {
+	if internalID < 0 || internalID >= t.TileCount || t.Columns <= 0 {
+		return image.Rectangle{}, false
+	}
+
+	x0 := t.Margin + (internalID%t.Columns)*(t.TileWidth+t.Spacing)
+	y0 := t.Margin + (internalID/t.Columns)*(t.TileHeight+t.Spacing)
+	return image.Rect(x0, y0, x0+t.TileWidth, y0+t.TileHeight), true
+}
+
+// TileDefinition returns the tileset data for the given tile or nil if there is none
+func (t *Tileset) TileDefinition(internalID int) *TilesetTile {
+	if t.tileDefinitionByID == nil {
+		// inline tilesets are never parsed from a TSX file
+		t.indexTileDefinitions()
+	}
+	return t.tileDefinitionByID[internalID]
 }
 
+// LoadFromTsx loads the tileset's TSX file relative to path and slices its image into tiles.
+// Inline tilesets have no TSX file, their image is resolved relative to path instead.
 func (t *Tileset) LoadFromTsx(path string) error {
-	tsxFile := &TSXFile{}
-	absTSXPath, err := filepath.Abs(filepath.Join(path, t.Source))
+	if t.Source == "" {
+		return t.loadInline(path)
+	}
+
+	tsxFile, absTSXPath, err := t.parseTsx(path)
+	if err != nil {
+		return err
+	}
+	if tsxFile.Image.Source == "" && tsxFile.Image.Data == nil {
+		return t.loadCollection(fileDir(t.fsys, absTSXPath))
+	}
+
+	tsxFile.Image.Source = t.resolveSource(tsxFile.Image.Source)
+	decodeStart := time.Now()
+	t.TilesetEbitenImage, t.TilesetImage, err = tsxFile.Image.load(t.fsys, fileDir(t.fsys, absTSXPath), t.decompressLimit())
+	if err != nil {
+		return err
+	}
+	t.imageDecodeTime = time.Since(decodeStart)
+
+	if err := t.checkColumns(); err != nil {
+		return err
+	}
+	t.sliceTiles()
+
+	return nil
+}
+
+// loadInline loads the image of a tileset embedded in the map, located in dir
+func (t *Tileset) loadInline(dir string) error {
+	if t.Image == nil {
+		if t.hasTileImages() {
+			t.indexTileDefinitions()
+			return t.loadCollection(dir)
+		}
+		return fmt.Errorf("inline tileset '%s' has no image", t.Name)
+	}
+
+	img := *t.Image
+	img.Source = t.resolveSource(img.Source)
+	decodeStart := time.Now()
+	var err error
+	t.TilesetEbitenImage, t.TilesetImage, err = img.load(t.fsys, dir, t.decompressLimit())
 	if err != nil {
 		return err
 	}
+	t.imageDecodeTime = time.Since(decodeStart)
+
+	if err := t.checkColumns(); err != nil {
+		return err
+	}
+	t.indexTileDefinitions()
+	t.sliceTiles()
+
+	return nil
+}
+
+// loadCollection loads the images of an image collection tileset, which has an image per tile
+// instead of a single image to slice, found relative to dir
+func (t *Tileset) loadCollection(dir string) error {
+	if !t.hasTileImages() {
+		return fmt.Errorf("tileset '%s' has no image", t.Name)
+	}
+
+	decodeStart := time.Now()
+	t.Tiles = make(map[int]*ebiten.Image)
+	for _, def := range t.TileDefinitions {
+		if def.Image == nil {
+			continue
+		}
+		img := *def.Image
+		img.Source = t.resolveSource(img.Source)
+		tileImage, _, err := img.load(t.fsys, dir, t.decompressLimit())
+		if err != nil {
+			return fmt.Errorf("tileset '%s': tile %d: %w", t.Name, def.ID, err)
+		}
+		t.Tiles[def.ID] = tileImage
+	}
+	t.imageDecodeTime = time.Since(decodeStart)
+	log.Debug().Int("numTiles", len(t.Tiles)).Str("tileset", t.Name).Msg("collection tiles loaded")
+
+	return nil
+}
+
+// hasTileImages reports whether tiles of the tileset have images of their own, as in image collection tilesets
+func (t *Tileset) hasTileImages() bool {
+	for _, def := range t.TileDefinitions {
+		if def.Image != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// tileIDLimit returns the internal id following the last tile of the tileset.
+// The tile ids of image collection tilesets may have gaps, so it can exceed the tile count.
+func (t *Tileset) tileIDLimit() int {
+	limit := t.TileCount
+	if t.Columns > 0 {
+		return limit
+	}
+	for _, def := range t.TileDefinitions {
+		if def.Image != nil && def.ID >= limit {
+			limit = def.ID + 1
+		}
+	}
+	return limit
+}
+
+// tileSize returns the size of the given tile, which varies per tile in image collection tilesets
+func (t *Tileset) tileSize(internalID int) (int, int) {
+	if img := t.Tiles[internalID]; img != nil {
+		return img.Size()
+	}
+	return t.TileWidth, t.TileHeight
+}
 
-	data, error := ioutil.ReadFile(absTSXPath)
+// checkColumns makes sure the tileset's tiles can be sliced from its image
+func (t *Tileset) checkColumns() error {
+	if t.TileCount > 0 && t.Columns <= 0 {
+		return fmt.Errorf("tileset '%s' has %d tiles but no columns", t.Name, t.TileCount)
+	}
+	return nil
+}
+
+// parseTsx reads the tileset's TSX file relative to path and fills in the tileset's metadata
+// without loading its image. It returns the parsed file and its absolute path.
+func (t *Tileset) parseTsx(path string) (*TSXFile, string, error) {
+	tsxFile := &TSXFile{}
+	absTSXPath, err := resolveFile(t.fsys, path, t.resolveSource(t.Source))
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, error := readFile(t.fsys, absTSXPath)
 	if error != nil {
-		return error
+		return nil, "", error
+	}
+	if err := xml.Unmarshal(data, tsxFile); err != nil {
+		return nil, "", fmt.Errorf("failed parsing tileset '%s': %w", absTSXPath, err)
 	}
-	_ = xml.Unmarshal([]byte(data), &tsxFile)
 
+	t.Name = tsxFile.Name
 	t.Version = tsxFile.Version
 	t.Tiledversion = tsxFile.TiledVersion
 	t.TileWidth = tsxFile.TileWidth
 	t.TileHeight = tsxFile.TileHeight
+	t.Spacing = tsxFile.Spacing
+	t.Margin = tsxFile.Margin
 	t.TileCount = tsxFile.TileCount
 	t.Columns = tsxFile.Columns
+	t.TileDefinitions = tsxFile.Tiles
+	t.Grid = tsxFile.Grid
+	t.Properties = tsxFile.Properties
 
-	absImgPath, err := filepath.Abs(filepath.Join(filepath.Dir(absTSXPath), tsxFile.Image.Source))
-	if err != nil {
-		return err
+	t.indexTileDefinitions()
+
+	return tsxFile, absTSXPath, nil
+}
+
+// resolveSource applies the source resolver set by WithTilesetSourceResolver
+func (t *Tileset) resolveSource(source string) string {
+	if t.sourceResolver == nil || source == "" {
+		return source
 	}
+	return t.sourceResolver(source)
+}
 
-	t.TilesetEbitenImage, t.TilesetImage, err = ebitenutil.NewImageFromFile(absImgPath)
-	if err != nil {
-		return err
+// resolvePath resolves a source path found in a file located in dir.
+// Absolute sources are used as they are.
+func resolvePath(dir, source string) string {
+	if filepath.IsAbs(source) {
+		return source
+	}
+	return filepath.Join(dir, source)
+}
+
+func (t *Tileset) indexTileDefinitions() {
+	t.tileDefinitionByID = make(map[int]*TilesetTile)
+	for _, def := range t.TileDefinitions {
+		t.tileDefinitionByID[def.ID] = def
 	}
+}
 
+// sliceTiles cuts the tileset image into the individual tile images
+func (t *Tileset) sliceTiles() {
 	log.Debug().Str("tileset", t.Name).Msg("pre-loading tiles")
 	t.Tiles = make(map[int]*ebiten.Image)
-	tileNum := 0
-	for ; tileNum < t.TileCount; tileNum++ {
-		x0 := (tileNum % t.Columns) * t.TileWidth
-		y0 := (tileNum / t.Columns) * t.TileWidth
-
-		tileRectangle := image.Rect(x0, y0, x0+t.TileWidth, y0+t.TileHeight)
+	for tileNum := 0; tileNum < t.TileCount; tileNum++ {
+		tileRectangle, ok := t.TileRect(tileNum)
+		if !ok {
+			break
+		}
 		t.Tiles[tileNum] = t.TilesetEbitenImage.SubImage(tileRectangle).(*ebiten.Image)
 	}
-	log.Debug().Int("numTiles", tileNum).Msg("tiles loaded")
-
-	return nil
+	log.Debug().Int("numTiles", len(t.Tiles)).Msg("tiles loaded")
 }
 
 const (
 	FLIPPED_HORIZONTALLY_FLAG uint32 = 0x80000000
 	FLIPPED_VERTICALLY_FLAG   uint32 = 0x40000000
 	FLIPPED_DIAGONALLY_FLAG   uint32 = 0x20000000
+
+	// GID_MASK strips the flip flags from an encoded gid
+	GID_MASK = (FLIPPED_DIAGONALLY_FLAG | FLIPPED_HORIZONTALLY_FLAG | FLIPPED_VERTICALLY_FLAG) ^ 0xffffffff
 )
 
 type Tile struct {
@@ -148,19 +413,138 @@ type Tile struct {
 	FlippedVertically   bool
 	FlippedDiagonally   bool
 	Tileset             *Tileset
+
+	// layer is the layer the tile was decoded into
+	layer *Layer
+	// raw is set when GlobalTileID keeps the flip flags
+	raw bool
+}
+
+// GID returns the tile's gid with the flip flags encoded
+func (t *Tile) GID() uint32 {
+	if t.raw {
+		return t.GlobalTileID
+	}
+	return t.encodeGID()
+}
+
+func (t *Tile) encodeGID() uint32 {
+	gid := t.GlobalTileID & GID_MASK
+	if t.FlippedHorizontally {
+		gid |= FLIPPED_HORIZONTALLY_FLAG
+	}
+	if t.FlippedVertically {
+		gid |= FLIPPED_VERTICALLY_FLAG
+	}
+	if t.FlippedDiagonally {
+		gid |= FLIPPED_DIAGONALLY_FLAG
+	}
+	return gid
+}
+
+// SetFlip changes the flip flags of the tile and marks its layer to be re-rendered on the next Render,
+// or the tile's chunk on the next DrawChunked.
+// For tiles loaded with WithRawGIDs the flags are also encoded into GlobalTileID.
+func (t *Tile) SetFlip(h, v, d bool) {
+	t.FlippedHorizontally = h
+	t.FlippedVertically = v
+	t.FlippedDiagonally = d
+	if t.raw {
+		t.GlobalTileID = t.encodeGID()
+	}
+	if t.layer != nil {
+		t.layer.dirty = true
+		t.layer.dataHash = 0
+		if t.layer.changedCells == nil {
+			t.layer.changedCells = make(map[image.Point]bool)
+		}
+		t.layer.changedCells[image.Pt(t.X, t.Y)] = true
+	}
 }
 
 func TileFromByteArray(data []byte) *Tile {
-	t := &Tile{}
-	encodedID := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+	return TileFromGID(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24)
+}
+
+// TileFromGID decodes a gid including its flip flags
+func TileFromGID(encodedID uint32) *Tile {
+	id, flags := DecodeGID(encodedID)
+	return &Tile{
+		GlobalTileID:        id,
+		FlippedHorizontally: flags.Horizontal(),
+		FlippedVertically:   flags.Vertical(),
+		FlippedDiagonally:   flags.Diagonal(),
+	}
+}
+
+// TileFlags holds the flip flags of an encoded gid
+type TileFlags uint32
+
+// Horizontal reports whether FLIPPED_HORIZONTALLY_FLAG is set
+func (f TileFlags) Horizontal() bool {
+	return uint32(f)&FLIPPED_HORIZONTALLY_FLAG != 0
+}
+
+// Vertical reports whether FLIPPED_VERTICALLY_FLAG is set
+func (f TileFlags) Vertical() bool {
+	return uint32(f)&FLIPPED_VERTICALLY_FLAG != 0
+}
+
+// Diagonal reports whether FLIPPED_DIAGONALLY_FLAG is set
+func (f TileFlags) Diagonal() bool {
+	return uint32(f)&FLIPPED_DIAGONALLY_FLAG != 0
+}
 
-	t.FlippedHorizontally = (encodedID & FLIPPED_HORIZONTALLY_FLAG) > 1
-	t.FlippedVertically = (encodedID & FLIPPED_VERTICALLY_FLAG) > 1
-	t.FlippedDiagonally = (encodedID & FLIPPED_DIAGONALLY_FLAG) > 1
+// DecodeGID splits an encoded gid into the global tile id and its flip flags
+func DecodeGID(gid uint32) (uint32, TileFlags) {
+	return gid & GID_MASK, TileFlags(gid &^ GID_MASK)
+}
+
+// Definition returns the tileset data of the tile, e.g. its properties, or nil if there is none
+func (t *Tile) Definition() *TilesetTile {
+	if t.Tileset == nil {
+		return nil
+	}
+	return t.Tileset.TileDefinition(int(t.InternalTileID))
+}
+
+// Properties returns the custom properties the tileset defines for the tile, nil if there are none
+func (t *Tile) Properties() Properties {
+	if def := t.Definition(); def != nil {
+		return def.Properties
+	}
+	return nil
+}
+
+// Rotation returns the clockwise rotation in degrees (0, 90, 180 or 270) described by the flip flags.
+// For the combinations that also mirror the tile (see Mirrored) it is the rotation applied
+// after flipping the tile horizontally.
+func (t *Tile) Rotation() int {
+	switch {
+	case t.FlippedDiagonally && t.FlippedHorizontally && t.FlippedVertically:
+		return 90
+	case t.FlippedDiagonally && t.FlippedHorizontally:
+		return 90
+	case t.FlippedDiagonally && t.FlippedVertically:
+		return 270
+	case t.FlippedDiagonally:
+		return 270
+	case t.FlippedHorizontally && t.FlippedVertically:
+		return 180
+	case t.FlippedVertically:
+		return 180
+	}
+	return 0
+}
 
-	t.GlobalTileID = encodedID & ((FLIPPED_DIAGONALLY_FLAG | FLIPPED_HORIZONTALLY_FLAG | FLIPPED_VERTICALLY_FLAG) ^ 0xffffffff)
+// Mirrored reports whether the flip flags mirror the tile in addition to rotating it
+func (t *Tile) Mirrored() bool {
+	return t.FlippedHorizontally != t.FlippedVertically != t.FlippedDiagonally
+}
 
-	return t
+// RawTileFromByteArray is like TileFromByteArray but keeps the flip flags in GlobalTileID
+func RawTileFromByteArray(data []byte) *Tile {
+	return &Tile{GlobalTileID: uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24, raw: true}
 }
 
 type DataEncoding string
@@ -178,87 +562,385 @@ const (
 	Zstd             = "zstd"
 )
 
+// Chunk is a block of the layer data of an infinite map
+type Chunk struct {
+	X      int    `xml:"x,attr"`
+	Y      int    `xml:"y,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+	Text   string `xml:",chardata"`
+}
+
+// LayerData is the encoded tile data of a layer
+type LayerData struct {
+	Text        string       `xml:",chardata"`
+	Encoding    DataEncoding `xml:"encoding,attr,omitempty"`
+	Compression Compression  `xml:"compression,attr,omitempty"`
+	// Chunks hold the data of infinite maps instead of Text
+	Chunks []Chunk `xml:"chunk"`
+}
+
 type Layer struct {
-	Text      string  `xml:",chardata"`
-	ID        uint    `xml:"id,attr"`
-	Name      string  `xml:"name,attr"`
-	X         int     `xml:"x,attr"`
-	Y         int     `xml:"y,attr"`
-	Width     int     `xml:"width,attr"`
-	Height    int     `xml:"height,attr"`
-	Opacity   float64 `xml:"opacity,attr"`
-	Visible   bool    `xml:"visible,attr"`
-	Tintcolor string  `xml:"tintcolor,attr"`
-	Offsetx   int     `xml:"offsetx,attr"`
-	Offsety   int     `xml:"offsety,attr"`
-	Tiles     []*Tile
-	Data      struct {
-		Text        string       `xml:",chardata"`
-		Encoding    DataEncoding `xml:"encoding,attr"`
-		Compression Compression  `xml:"compression,attr"`
-	} `xml:"data"`
-	Rendered *ebiten.Image
+	ID         uint          `xml:"id,attr"`
+	Name       string        `xml:"name,attr,omitempty"`
+	Class      string        `xml:"class,attr,omitempty"`
+	X          int           `xml:"x,attr,omitempty"`
+	Y          int           `xml:"y,attr,omitempty"`
+	Width      int           `xml:"width,attr,omitempty"`
+	Height     int           `xml:"height,attr,omitempty"`
+	Opacity    float64       `xml:"opacity,attr"`
+	Visible    Visibility    `xml:"visible,attr"`
+	Tintcolor  string        `xml:"tintcolor,attr,omitempty"`
+	Offsetx    int           `xml:"offsetx,attr,omitempty"`
+	Offsety    int           `xml:"offsety,attr,omitempty"`
+	Properties Properties    `xml:"properties"`
+	Tiles      []*Tile       `xml:"-"` // non-empty cells in row-major order, see DecodeData
+	Data       LayerData     `xml:"data"`
+	Rendered   *ebiten.Image `xml:"-"`
+
+	// animated is set when the last render contained animated tiles
+	animated   bool
+	renderedAt time.Duration
+	// dirty is set when tiles changed since the last render
+	dirty bool
+	// changedCells holds the cells of tiles changed since the last DrawChunked
+	changedCells map[image.Point]bool
+	// renderedVisible is the visibility of the layer at the last render
+	renderedVisible Visibility
+	// pending is the map to decode the layer with when it's first used, see WithLazyDecode
+	pending *TmxMap
+	// dataHash identifies the raw layer data, see Reload. It's 0 once the tiles were edited,
+	// as they no longer match the data.
+	dataHash uint64
+	// grid holds the tiles indexed by cellIndex over Bounds if WithTileGrid is set
+	grid []*Tile
+	// view is the camera view of viewOf last returned by Render
+	view     *ebiten.Image
+	viewOf   *ebiten.Image
+	viewRect image.Rectangle
 }
 
+// DecodeData decodes the layer data into Tiles, always in row-major order. Decoding is sequential:
+// the chunks of infinite maps are decoded one after another in document order and the tiles are
+// sorted afterwards. Chunks are placed at their position, so tiles may have negative coordinates.
 func (l *Layer) DecodeData(gameMap *TmxMap) error {
-	if l.Data.Encoding == Base64 {
-		byteArray, err := base64.StdEncoding.DecodeString(strings.TrimSpace(l.Data.Text))
-		if err != nil {
+	if len(l.Data.Chunks) == 0 {
+		if err := l.decodeBlock(gameMap, l.Data.Text, 0, 0, l.Width); err != nil {
 			return err
 		}
+	} else {
+		for _, chunk := range l.Data.Chunks {
+			if err := l.decodeBlock(gameMap, chunk.Text, chunk.X, chunk.Y, chunk.Width); err != nil {
+				return err
+			}
+		}
+		sort.SliceStable(l.Tiles, func(i, j int) bool {
+			if l.Tiles[i].Y != l.Tiles[j].Y {
+				return l.Tiles[i].Y < l.Tiles[j].Y
+			}
+			return l.Tiles[i].X < l.Tiles[j].X
+		})
+	}
 
-		tileNum := 0
+	if gameMap.options.tileGrid {
+		l.buildGrid()
+	}
+	return nil
+}
+
+// buildGrid indexes the tiles by cell for GetTileAt, see WithTileGrid
+func (l *Layer) buildGrid() {
+	bounds := l.Bounds()
+	l.grid = make([]*Tile, bounds.Dx()*bounds.Dy())
+	for _, tile := range l.Tiles {
+		if i, ok := cellIndex(bounds, tile.X, tile.Y); ok {
+			l.grid[i] = tile
+		}
+	}
+}
+
+// Bounds returns the cells covered by the layer data. That's the layer size for finite maps
+// and the union of the chunks for infinite maps, which may start at negative cells.
+func (l *Layer) Bounds() image.Rectangle {
+	if len(l.Data.Chunks) == 0 {
+		return image.Rect(0, 0, l.Width, l.Height)
+	}
+	var bounds image.Rectangle
+	for _, chunk := range l.Data.Chunks {
+		bounds = bounds.Union(image.Rect(chunk.X, chunk.Y, chunk.X+chunk.Width, chunk.Y+chunk.Height))
+	}
+	return bounds
+}
+
+// cellIndex returns the index of cell x, y in a row-major grid covering bounds,
+// ok is false if the cell is outside of bounds
+func cellIndex(bounds image.Rectangle, x, y int) (int, bool) {
+	if !image.Pt(x, y).In(bounds) {
+		return 0, false
+	}
+	return (y-bounds.Min.Y)*bounds.Dx() + x - bounds.Min.X, true
+}
+
+// decodeBlock decodes a block of encoded layer data with the given width whose top left cell is at x0, y0
+func (l *Layer) decodeBlock(gameMap *TmxMap, text string, x0, y0, width int) error {
+	var gids []uint32
+	switch l.Data.Encoding {
+	case Base64:
+		byteArray, err := decodeBase64(text, l.Data.Compression, gameMap.options.maxDecompressedSize)
+		if err != nil {
+			return err
+		}
+		gids = make([]uint32, 0, len(byteArray)/4)
 		for i := 0; i <= len(byteArray)-4; i += 4 {
-			newTile := TileFromByteArray(byteArray[i : i+4])
-
-			if newTile.GlobalTileID != 0 {
-				for i := range gameMap.Tilesets {
-					if newTile.GlobalTileID >= gameMap.Tilesets[i].FirstGid {
-						newTile.Tileset = gameMap.Tilesets[i]
-					}
-				}
-				if newTile.Tileset == nil {
-					return errors.New("couldn't find tileset for " + newTile.Tileset.Source)
-				}
-
-				newTile.X = tileNum % l.Width
-				newTile.Y = tileNum / l.Height
-
-				newTile.InternalTileID = newTile.GlobalTileID - newTile.Tileset.FirstGid
-				l.Tiles = append(l.Tiles, newTile)
-			}
+			gids = append(gids, binary.LittleEndian.Uint32(byteArray[i:i+4]))
+		}
+	case CSV:
+		var err error
+		gids, err = decodeCSV(text)
+		if err != nil {
+			return fmt.Errorf("layer '%s': %w", l.Name, err)
+		}
+	default:
+		return fmt.Errorf("layer '%s' has unsupported encoding '%s'", l.Name, l.Data.Encoding)
+	}
+	if width <= 0 {
+		return fmt.Errorf("layer '%s' has invalid width %d", l.Name, width)
+	}
 
-			tileNum++
+	for tileNum, encodedID := range gids {
+		newTile, err := l.newTile(gameMap, encodedID, x0+tileNum%width, y0+tileNum/width)
+		if err != nil {
+			return err
+		}
+		if newTile != nil {
+			l.Tiles = append(l.Tiles, newTile)
 		}
 	}
 	return nil
 }
 
+// newTile creates the tile of the layer for an encoded gid at the given cell and resolves its tileset.
+// It returns nil for empty cells.
+func (l *Layer) newTile(gameMap *TmxMap, encodedID uint32, x, y int) (*Tile, error) {
+	var newTile *Tile
+	if gameMap.options.rawGIDs {
+		newTile = &Tile{GlobalTileID: encodedID, raw: true}
+	} else {
+		newTile = TileFromGID(encodedID)
+	}
+	gid := newTile.GlobalTileID & GID_MASK
+	if gid == 0 {
+		return nil, nil
+	}
+
+	newTile.layer = l
+	newTile.X = x
+	newTile.Y = y
+
+	newTile.Tileset = gameMap.TilesetForGID(gid)
+	if newTile.Tileset != nil {
+		newTile.InternalTileID = gid - newTile.Tileset.FirstGid
+	} else if gameMap.options.missingTilePlaceholders {
+		log.Warn().Str("layer", l.Name).Uint32("gid", gid).Int("x", newTile.X).Int("y", newTile.Y).Msg("unresolved gid")
+		newTile.Tileset = gameMap.placeholderTileset()
+	} else {
+		return nil, fmt.Errorf("couldn't find tileset for gid %d", gid)
+	}
+	return newTile, nil
+}
+
+// ensureDecoded decodes the layer data if it was deferred by WithLazyDecode
+func (l *Layer) ensureDecoded() {
+	if l.pending == nil {
+		return
+	}
+	gameMap := l.pending
+	l.pending = nil
+	if err := l.DecodeData(gameMap); err != nil {
+		log.Error().Err(err).Str("layer", l.Name).Msg("failed decoding layer")
+	}
+}
+
+// GetTileAt returns the tile at the given cell of the layer, nil if the cell is empty
+// or outside of the layer's Bounds
+func (l *Layer) GetTileAt(x, y int) *Tile {
+	i, ok := cellIndex(l.Bounds(), x, y)
+	if !ok {
+		return nil
+	}
+	l.ensureDecoded()
+	if l.grid != nil {
+		return l.grid[i]
+	}
+	for _, tile := range l.Tiles {
+		if tile.X == x && tile.Y == y {
+			return tile
+		}
+	}
+	return nil
+}
+
+// Render returns the rendered layer, with the layer opacity applied to its tiles. Hidden layers render empty.
+// Only the map area from 0, 0 to the map's pixel size is rendered, tiles of infinite maps outside of it
+// are left out; use DrawChunked to draw those.
+// The render is cached and only rebuilt when refresh is set or the layer changed.
 func (l *Layer) Render(gameMap *TmxMap, scale float64, refresh bool) *ebiten.Image {
-	if l.Rendered == nil || refresh {
-		op := &ebiten.DrawImageOptions{}
-		renderStart := time.Now()
-		rendered := ebiten.NewImage(gameMap.PixelWidth, gameMap.PixelHeight)
-		for _, tile := range l.Tiles {
-			op.GeoM.Reset()
-			op.GeoM.Translate(float64(tile.X*gameMap.TileWidth), float64(tile.Y*gameMap.TileHeight))
-			rendered.DrawImage(tile.Tileset.Tiles[int(tile.InternalTileID)], op)
+	rendered := l.render(gameMap, refresh)
+	cam := gameMap.UpdateScaledCam(scale)
+	// the view only changes along with the camera or the render
+	if l.view == nil || l.viewOf != rendered || l.viewRect != cam {
+		l.view = rendered.SubImage(cam).(*ebiten.Image)
+		l.viewOf = rendered
+		l.viewRect = cam
+	}
+	return l.view
+}
+
+// render returns the cached render of the whole layer, rebuilding it if needed.
+// Animated tiles whose frame changed are redrawn in place instead of rebuilding the whole render.
+func (l *Layer) render(gameMap *TmxMap, refresh bool) *ebiten.Image {
+	l.ensureDecoded()
+	if l.Rendered != nil && !refresh && !l.dirty && l.renderedVisible == l.Visible {
+		if l.animated && l.renderedAt != gameMap.animationTime {
+			l.redrawAnimated(gameMap)
 		}
-		l.Rendered = rendered
-		t := time.Now()
-		elapsed := t.Sub(renderStart)
-		log.Debug().Msgf("%s: refreshing layer took %f\n", l.Name, elapsed.Seconds())
+		return l.Rendered
 	}
 
-	scaledWidth := int(float64(gameMap.CameraBounds.Max.X) / scale)
-	scaledHeight := int(float64(gameMap.CameraBounds.Max.Y) / scale)
+	op := &ebiten.DrawImageOptions{}
+	renderStart := time.Now()
+	if l.Rendered != nil && l.Rendered.Bounds().Size() == image.Pt(gameMap.PixelWidth, gameMap.PixelHeight) {
+		l.Rendered.Clear()
+	} else {
+		l.Invalidate()
+		l.Rendered = ebiten.NewImage(gameMap.PixelWidth, gameMap.PixelHeight)
+	}
+	l.animated = false
+	// hidden layers render empty
+	if l.Visible {
+		for _, tile := range l.tilesInRenderOrder(gameMap.Renderorder) {
+			if l.drawTile(l.Rendered, gameMap, tile, image.Point{}, op) {
+				l.animated = true
+			}
+		}
+	}
+	l.renderedVisible = l.Visible
+	l.renderedAt = gameMap.animationTime
+	l.dirty = false
+	t := time.Now()
+	elapsed := t.Sub(renderStart)
+	log.Debug().Msgf("%s: refreshing layer took %f\n", l.Name, elapsed.Seconds())
+
+	return l.Rendered
+}
+
+// redrawAnimated redraws the animated tiles whose frame changed since the last render
+func (l *Layer) redrawAnimated(gameMap *TmxMap) {
+	previous := l.renderedAt
+	l.renderedAt = gameMap.animationTime
+	for _, tile := range l.Tiles {
+		def := tile.Definition()
+		if def == nil || len(def.Animation) == 0 {
+			continue
+		}
+		if frameAt(def.Animation, previous) != frameAt(def.Animation, gameMap.animationTime) {
+			l.redrawRegion(gameMap, l.tileRect(gameMap, tile))
+		}
+	}
+}
+
+// tilesInRenderOrder returns the layer's tiles in the order they are drawn with the given render order
+func (l *Layer) tilesInRenderOrder(order RenderOrder) []*Tile {
+	up := order == RightUp || order == LeftUp
+	left := order == LeftDown || order == LeftUp
+	if !up && !left {
+		return l.Tiles
+	}
+
+	tiles := make([]*Tile, len(l.Tiles))
+	copy(tiles, l.Tiles)
+	sort.Slice(tiles, func(i, j int) bool {
+		if tiles[i].Y != tiles[j].Y {
+			return (tiles[i].Y < tiles[j].Y) != up
+		}
+		return (tiles[i].X < tiles[j].X) != left
+	})
+	return tiles
+}
+
+// drawTile draws a single tile onto dst whose top left corner is at origin in map pixels,
+// shifted by the layer offset.
+// It returns whether the tile is animated.
+func (l *Layer) drawTile(dst *ebiten.Image, gameMap *TmxMap, tile *Tile, origin image.Point, op *ebiten.DrawImageOptions) bool {
+	img := tile.Tileset.TileImage(int(tile.InternalTileID), gameMap.animationTime)
+	w, h := img.Size()
+	// changes made by the draw hook must not leak into the next tile
+	*op = ebiten.DrawImageOptions{}
+	op.GeoM = flipGeoM(TileFlags(tile.encodeGID()), float64(w), float64(h))
+	// tiles larger or smaller than the map grid are aligned to the bottom left of their cell like in Tiled
+	pos := gameMap.TileToPixel(tile.X, tile.Y)
+	op.GeoM.Translate(
+		float64(pos.X+l.Offsetx-origin.X),
+		float64(pos.Y+gameMap.TileHeight-h+l.Offsety-origin.Y),
+	)
+	op.ColorM.Scale(1, 1, 1, l.Opacity)
+	if tint, ok := l.Tint(); ok {
+		op.ColorM.Scale(float64(tint.R)/0xff, float64(tint.G)/0xff, float64(tint.B)/0xff, float64(tint.A)/0xff)
+	}
+	if gameMap.options.tileDrawHook != nil {
+		gameMap.options.tileDrawHook(tile, op)
+	}
+	dst.DrawImage(img, op)
+	return tile.Tileset.isAnimated(int(tile.InternalTileID))
+}
 
-	gameMap.ScaledCam.Min.X = gameMap.CameraPosition.X - scaledWidth/2
-	gameMap.ScaledCam.Min.Y = gameMap.CameraPosition.Y - scaledHeight/2
-	gameMap.ScaledCam.Max.X = gameMap.ScaledCam.Min.X + scaledWidth
-	gameMap.ScaledCam.Max.Y = gameMap.ScaledCam.Min.Y + scaledHeight
+// Invalidate drops the cached render, so the next Render rebuilds it.
+// Images previously returned by Render must not be used afterwards.
+func (l *Layer) Invalidate() {
+	if l.Rendered != nil {
+		l.Rendered.Dispose()
+		l.Rendered = nil
+	}
+}
+
+// TilesetForGID returns the tileset owning the given gid (without flip flags) or nil
+func (t *TmxMap) TilesetForGID(gid uint32) *Tileset {
+	if gid == 0 {
+		return nil
+	}
+
+	var tileset *Tileset
+	for i := range t.Tilesets {
+		if gid >= t.Tilesets[i].FirstGid {
+			tileset = t.Tilesets[i]
+		}
+	}
+	if tileset == nil {
+		return nil
+	}
+	if limit := tileset.tileIDLimit(); limit > 0 && gid >= tileset.FirstGid+uint32(limit) {
+		// beyond the last tileset
+		return nil
+	}
+	return tileset
+}
 
-	return l.Rendered.SubImage(gameMap.ScaledCam).(*ebiten.Image)
+// placeholderTileset returns a tileset with a single magenta tile used for unresolved gids
+func (t *TmxMap) placeholderTileset() *Tileset {
+	if t.placeholder == nil {
+		img := ebiten.NewImage(t.TileWidth, t.TileHeight)
+		img.Fill(color.RGBA{R: 0xff, B: 0xff, A: 0xff})
+		t.placeholder = &Tileset{
+			Name:               "missing",
+			TileWidth:          t.TileWidth,
+			TileHeight:         t.TileHeight,
+			TileCount:          1,
+			Columns:            1,
+			TilesetEbitenImage: img,
+			Tiles:              map[int]*ebiten.Image{0: img},
+		}
+	}
+	return t.placeholder
 }
 
 func (t TmxMap) GetLayerByName(name string) *Layer {
@@ -270,19 +952,61 @@ func (t TmxMap) GetLayerByName(name string) *Layer {
 	return nil
 }
 
+// LayersByClass returns all tile layers whose class matches, in document order
+func (t *TmxMap) LayersByClass(class string) []*Layer {
+	var layers []*Layer
+	for i := range t.Layers {
+		if t.Layers[i].Class == class {
+			layers = append(layers, t.Layers[i])
+		}
+	}
+	return layers
+}
+
 type Object struct {
-	Text     string  `xml:",chardata"`
-	ID       int     `xml:"id,attr"`
-	Name     string  `xml:"name,attr"`
-	Type     string  `xml:"type,attr"`
-	X        int     `xml:"x,attr"`
-	Y        int     `xml:"y,attr"`
-	Width    int     `xml:"width,attr"`
-	Height   int     `xml:"height,attr"`
-	Rotation float64 `xml:"rotation,attr"`
-	Gid      uint32  `xml:"gid,attr"`
-	Visible  bool    `xml:"visible,attr"`
-	Template string  `xml:"template,attr"`
+	ID       int        `xml:"id,attr"`
+	Name     string     `xml:"name,attr,omitempty"`
+	Type     string     `xml:"type,attr,omitempty"`
+	X        int        `xml:"x,attr"`
+	Y        int        `xml:"y,attr"`
+	Width    int        `xml:"width,attr,omitempty"`
+	Height   int        `xml:"height,attr,omitempty"`
+	Rotation float64    `xml:"rotation,attr,omitempty"`
+	Gid      uint32     `xml:"gid,attr,omitempty"`
+	Visible  Visibility `xml:"visible,attr"`
+	Template string     `xml:"template,attr,omitempty"`
+
+	Properties Properties `xml:"properties"`
+	Polygon    *Polygon   `xml:"polygon"`
+	Polyline   *Polygon   `xml:"polyline"`
+	Ellipse    *struct{}  `xml:"ellipse"`
+	Point      *struct{}  `xml:"point"`
+	// Tile is the tile referenced by Gid, nil for objects without a gid
+	Tile *Tile `xml:"-"`
+}
+
+func (o *Object) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type object Object
+	decoded := object{Visible: true}
+	if err := d.DecodeElement(&decoded, &start); err != nil {
+		return err
+	}
+	*o = Object(decoded)
+	return nil
+}
+
+// GetStringProperty returns the named property of the object, falling back to
+// the properties of the referenced tile like Tiled does
+func (o *Object) GetStringProperty(name string) (string, bool) {
+	if value, ok := o.Properties.GetString(name); ok {
+		return value, true
+	}
+	if o.Tile != nil {
+		if def := o.Tile.Definition(); def != nil {
+			return def.Properties.GetString(name)
+		}
+	}
+	return "", false
 }
 
 type DrawOrder string
@@ -293,80 +1017,217 @@ const (
 )
 
 type ObjectGroup struct {
-	Text      string    `xml:",chardata"`
-	ID        int       `xml:"id,attr"`
-	Name      string    `xml:"name,attr"`
-	Color     string    `xml:"color,attr"`
-	X         int       `xml:"x,attr"`
-	Y         int       `xml:"y,attr"`
-	Width     int       `xml:"width,attr"`
-	Height    int       `xml:"height,attr"`
-	Opacity   float64   `xml:"opacity,attr"`
-	Visible   bool      `xml:"visible,attr"`
-	Tintcolor string    `xml:"tintcolor,attr"`
-	Offsetx   bool      `xml:"offsetx,attr"`
-	OffsetY   bool      `xml:"offsety,attr"`
-	DrawOrder DrawOrder `xml:"draworder,attr"`
-	Objects   []*Object `xml:"object"`
-	Rendered  *ebiten.Image
-}
-
-func (o *ObjectGroup) DebugRender(gameMap *TmxMap, scale float64) *ebiten.Image {
-	if o.Rendered == nil {
+	ID         int           `xml:"id,attr"`
+	Name       string        `xml:"name,attr,omitempty"`
+	Class      string        `xml:"class,attr,omitempty"`
+	Color      string        `xml:"color,attr,omitempty"`
+	X          int           `xml:"x,attr,omitempty"`
+	Y          int           `xml:"y,attr,omitempty"`
+	Width      int           `xml:"width,attr,omitempty"`
+	Height     int           `xml:"height,attr,omitempty"`
+	Opacity    float64       `xml:"opacity,attr"`
+	Visible    Visibility    `xml:"visible,attr"`
+	Tintcolor  string        `xml:"tintcolor,attr,omitempty"`
+	Offsetx    bool          `xml:"offsetx,attr,omitempty"`
+	OffsetY    bool          `xml:"offsety,attr,omitempty"`
+	ParallaxX  float64       `xml:"parallaxx,attr"`
+	ParallaxY  float64       `xml:"parallaxy,attr"`
+	DrawOrder  DrawOrder     `xml:"draworder,attr,omitempty"`
+	Properties Properties    `xml:"properties"`
+	Objects    []*Object     `xml:"object"`
+	Rendered   *ebiten.Image `xml:"-"`
+
+	// renderedColor is the outline color of the last DebugRender
+	renderedColor color.Color
+}
+
+func (o *ObjectGroup) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	// Tiled omits the opacity and parallax factors when they are 1 and visible when it's true
+	type objectGroup ObjectGroup
+	group := objectGroup{Opacity: 1, ParallaxX: 1, ParallaxY: 1, Visible: true}
+	if err := d.DecodeElement(&group, &start); err != nil {
+		return err
+	}
+	*o = ObjectGroup(group)
+	return nil
+}
+
+// DebugRender returns the camera view of the outlines of the group's objects, rotated around their
+// origin like in Tiled. The outlines are drawn in the group's color unless WithOutlineColor is given.
+// The render is cached and only rebuilt when the outline color changes or after Invalidate.
+func (o *ObjectGroup) DebugRender(gameMap *TmxMap, scale float64, opts ...DebugRenderOption) *ebiten.Image {
+	d := debugRenderOptions{color: defaultOutlineColor}
+	if o.Color != "" {
+		if c, err := parseColor(o.Color); err == nil {
+			d.color = c
+		}
+	}
+	for _, opt := range opts {
+		opt(&d)
+	}
+
+	if o.Rendered == nil || o.renderedColor != d.color {
 		renderStart := time.Now()
-		rendered := ebiten.NewImage(gameMap.PixelWidth, gameMap.PixelHeight)
-		op := &ebiten.DrawImageOptions{}
+		if o.Rendered == nil {
+			o.Rendered = ebiten.NewImage(gameMap.PixelWidth, gameMap.PixelHeight)
+		} else {
+			o.Rendered.Clear()
+		}
 		for _, obj := range o.Objects {
-			objImg := ebiten.NewImage(obj.Width, obj.Height)
-			objImg.Fill(image.Black)
-
-			op.GeoM.Reset()
-			op.GeoM.Translate(float64(obj.X), float64(obj.Y))
-			rendered.DrawImage(objImg, op)
-			log.Debug().Msgf("Object: %s, [%d,%d],[%d,%d]\n", obj.Name, obj.X, obj.Y, obj.Width, obj.Height)
+			if !obj.Visible {
+				continue
+			}
+			obj.drawOutline(o.Rendered, d.color)
+			log.Debug().Msgf("Object: %s, [%d,%d],[%d,%d] %f°\n", obj.Name, obj.X, obj.Y, obj.Width, obj.Height, obj.Rotation)
 		}
-		o.Rendered = rendered
+		o.renderedColor = d.color
 		t := time.Now()
 		elapsed := t.Sub(renderStart)
 		log.Debug().Msgf("%s: refreshing layer took %f\n", o.Name, elapsed.Seconds())
 	}
-	scaledWidth := int(float64(gameMap.CameraBounds.Max.X) / scale)
-	scaledHeight := int(float64(gameMap.CameraBounds.Max.Y) / scale)
-
-	gameMap.ScaledCam.Min.X = gameMap.CameraPosition.X - scaledWidth/2
-	gameMap.ScaledCam.Min.Y = gameMap.CameraPosition.Y - scaledHeight/2
-	gameMap.ScaledCam.Max.X = gameMap.ScaledCam.Min.X + scaledWidth
-	gameMap.ScaledCam.Max.Y = gameMap.ScaledCam.Min.Y + scaledHeight
+	gameMap.UpdateScaledCam(scale)
+	return o.Rendered.SubImage(gameMap.parallaxCam(scale, o.ParallaxX, o.ParallaxY)).(*ebiten.Image)
+}
 
-	return o.Rendered.SubImage(gameMap.ScaledCam).(*ebiten.Image)
+// Invalidate drops the cached render, so the next DebugRender rebuilds it.
+// Images previously returned by DebugRender must not be used afterwards.
+func (o *ObjectGroup) Invalidate() {
+	if o.Rendered != nil {
+		o.Rendered.Dispose()
+		o.Rendered = nil
+	}
 }
 
 type TmxMap struct {
-	XMLName          xml.Name    `xml:"map"`
-	Text             string      `xml:",chardata"`
-	Version          string      `xml:"version,attr"`
-	Tiledversion     string      `xml:"tiledversion,attr"`
-	Orientation      Orientation `xml:"orientation,attr"`
-	Renderorder      RenderOrder `xml:"renderorder,attr"`
-	Compressionlevel int         `xml:"compressionlevel,attr"`
-	Width            int         `xml:"width,attr"`
-	Height           int         `xml:"height,attr"`
-	PixelWidth       int
-	PixelHeight      int
-	TileWidth        int            `xml:"tilewidth,attr"`
-	TileHeight       int            `xml:"tileheight,attr"`
-	HexSideLength    int            `xml:"hexsidelength,attr"`
-	StaggerAxis      int            `xml:"staggeraxis,attr"`
-	BackgroundColor  string         `xml:"backgroundcolor,attr"`
-	Infinite         int            `xml:"infinite,attr"`
-	NextLayerID      int            `xml:"nextlayerid,attr"`
-	NextObjectID     int            `xml:"nextobjectid,attr"`
-	Tilesets         []*Tileset     `xml:"tileset"`
-	Layers           []*Layer       `xml:"layer"`
-	ObjectGroups     []*ObjectGroup `xml:"objectgroup"`
-	CameraPosition   image.Point
-	CameraBounds     image.Rectangle
-	ScaledCam        image.Rectangle
+	XMLName          xml.Name        `xml:"map"`
+	Version          string          `xml:"version,attr,omitempty"`
+	Tiledversion     string          `xml:"tiledversion,attr,omitempty"`
+	Orientation      Orientation     `xml:"orientation,attr"`
+	Renderorder      RenderOrder     `xml:"renderorder,attr"`
+	Compressionlevel int             `xml:"compressionlevel,attr"`
+	Width            int             `xml:"width,attr,omitempty"`
+	Height           int             `xml:"height,attr,omitempty"`
+	PixelWidth       int             `xml:"-"`
+	PixelHeight      int             `xml:"-"`
+	TileWidth        int             `xml:"tilewidth,attr,omitempty"`
+	TileHeight       int             `xml:"tileheight,attr,omitempty"`
+	HexSideLength    int             `xml:"hexsidelength,attr,omitempty"`
+	StaggerAxis      string          `xml:"staggeraxis,attr,omitempty"`
+	StaggerIndex     string          `xml:"staggerindex,attr,omitempty"`
+	BackgroundColor  string          `xml:"backgroundcolor,attr,omitempty"`
+	Infinite         int             `xml:"infinite,attr"`
+	ParallaxOriginX  int             `xml:"parallaxoriginx,attr,omitempty"`
+	ParallaxOriginY  int             `xml:"parallaxoriginy,attr,omitempty"`
+	NextLayerID      int             `xml:"nextlayerid,attr"`
+	NextObjectID     int             `xml:"nextobjectid,attr"`
+	EditorSettings   *EditorSettings `xml:"editorsettings"`
+	Properties       Properties      `xml:"properties"`
+	Tilesets         []*Tileset      `xml:"tileset"`
+	// LayerStack holds the tile layers, object groups and image layers in document order, bottom first,
+	// which is the order to draw them in. Layers, ObjectGroups and ImageLayers are filled from it
+	// when unmarshaling.
+	LayerStack     []*LayerEntry   `xml:",any"`
+	Layers         []*Layer        `xml:"-"`
+	ObjectGroups   []*ObjectGroup  `xml:"-"`
+	ImageLayers    []*ImageLayer   `xml:"-"`
+	CameraPosition image.Point     `xml:"-"`
+	CameraOffset   image.Point     `xml:"-"`
+	CameraBounds   image.Rectangle `xml:"-"`
+	ScaledCam      image.Rectangle `xml:"-"`
+
+	options         loadOptions
+	animationTime   time.Duration
+	chunks          *chunkCache
+	placeholder     *Tileset
+	colliders       *colliderGrid
+	collidersOf     [][]*Object
+	colliderObjects []*Object
+	collisionGroups []string
+}
+
+// EditorSettings holds the editor specific settings stored in a map
+type EditorSettings struct {
+	ChunkSize *struct {
+		Width  int `xml:"width,attr"`
+		Height int `xml:"height,attr"`
+	} `xml:"chunksize"`
+	Export *struct {
+		Target string `xml:"target,attr"`
+		Format string `xml:"format,attr"`
+	} `xml:"export"`
+}
+
+// ChunkSize returns the chunk size in tiles configured in the editor settings, 16x16 if unset
+func (t *TmxMap) ChunkSize() image.Point {
+	if t.EditorSettings != nil && t.EditorSettings.ChunkSize != nil &&
+		t.EditorSettings.ChunkSize.Width > 0 && t.EditorSettings.ChunkSize.Height > 0 {
+		return image.Pt(t.EditorSettings.ChunkSize.Width, t.EditorSettings.ChunkSize.Height)
+	}
+	return image.Pt(16, 16)
+}
+
+// UpdateScaledCam recomputes ScaledCam for the given scale and returns it.
+// CameraOffset is added on top of CameraPosition, so effects like screen shake
+// can move the view without touching the logical camera position.
+func (t *TmxMap) UpdateScaledCam(scale float64) image.Rectangle {
+	t.ScaledCam = t.scaledCam(scale)
+	return t.ScaledCam
+}
+
+func (t *TmxMap) scaledCam(scale float64) image.Rectangle {
+	scaledWidth := int(float64(t.CameraBounds.Max.X) / scale)
+	scaledHeight := int(float64(t.CameraBounds.Max.Y) / scale)
+
+	center := t.CameraPosition.Add(t.CameraOffset)
+	min := image.Pt(center.X-scaledWidth/2, center.Y-scaledHeight/2)
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(scaledWidth, scaledHeight))}
+}
+
+// InvalidateAll drops the cached renders of all layers and object groups
+func (t *TmxMap) InvalidateAll() {
+	for _, layer := range t.Layers {
+		layer.Invalidate()
+	}
+	for _, group := range t.ObjectGroups {
+		group.Invalidate()
+	}
+	for _, layer := range t.ImageLayers {
+		layer.Invalidate()
+	}
+	if t.chunks != nil {
+		t.chunks.clear()
+	}
+}
+
+// parallaxCam returns the camera view for a layer with the given parallax factors.
+// The layer moves at the given fraction of the camera movement relative to the parallax origin.
+func (t *TmxMap) parallaxCam(scale, parallaxX, parallaxY float64) image.Rectangle {
+	cam := t.scaledCam(scale)
+	if parallaxX == 1 && parallaxY == 1 {
+		return cam
+	}
+
+	center := t.CameraPosition.Add(t.CameraOffset)
+	shift := image.Pt(
+		int(float64(center.X-t.ParallaxOriginX)*(parallaxX-1)),
+		int(float64(center.Y-t.ParallaxOriginY)*(parallaxY-1)),
+	)
+	return cam.Add(shift)
+}
+
+// VisibleTileRange returns the tile coordinates intersecting the camera view.
+// Unlike usual for image.Rectangle, Max is inclusive. If no tile is visible
+// the returned rectangle has Max < Min.
+func (t *TmxMap) VisibleTileRange(scale float64) image.Rectangle {
+	cam := t.scaledCam(scale).Intersect(image.Rect(0, 0, t.Width*t.TileWidth, t.Height*t.TileHeight))
+	if cam.Empty() {
+		return image.Rectangle{Max: image.Pt(-1, -1)}
+	}
+
+	return image.Rectangle{
+		Min: image.Pt(cam.Min.X/t.TileWidth, cam.Min.Y/t.TileHeight),
+		Max: image.Pt((cam.Max.X-1)/t.TileWidth, (cam.Max.Y-1)/t.TileHeight),
+	}
 }
 
 func (t TmxMap) GetObjectGroupByName(name string) *ObjectGroup {
@@ -378,72 +1239,443 @@ func (t TmxMap) GetObjectGroupByName(name string) *ObjectGroup {
 	return nil
 }
 
-func (t TmxMap) CheckColisionPoint(subject image.Point) bool {
-	collisionLayer := t.GetObjectGroupByName("collisionmap")
+// EachObject calls fn for every object of the map together with its owning group.
+// Groups are visited in document order and the objects of each group in document order.
+func (t *TmxMap) EachObject(fn func(group *ObjectGroup, obj *Object)) {
+	for _, group := range t.ObjectGroups {
+		for _, object := range group.Objects {
+			fn(group, object)
+		}
+	}
+}
 
-	for _, object := range collisionLayer.Objects {
-		if subject.X >= object.X && subject.X <= object.X+object.Width &&
-			subject.Y >= object.Y && subject.Y <= object.Y+object.Height {
+// GetObjectByID returns the object with the given id from any object group, nil if there is none
+func (t *TmxMap) GetObjectByID(id int) *Object {
+	for _, group := range t.ObjectGroups {
+		for _, object := range group.Objects {
+			if object.ID == id {
+				return object
+			}
+		}
+	}
+	return nil
+}
 
-			return true
+// GetObjectByName returns the first object with the given name in document order, nil if there is none
+func (t *TmxMap) GetObjectByName(name string) *Object {
+	for _, group := range t.ObjectGroups {
+		for _, object := range group.Objects {
+			if object.Name == name {
+				return object
+			}
 		}
 	}
-	return false
+	return nil
+}
+
+// GetObjectsByType returns all objects of the given type in document order
+func (t *TmxMap) GetObjectsByType(typ string) []*Object {
+	var objects []*Object
+	t.EachObject(func(_ *ObjectGroup, object *Object) {
+		if object.Type == typ {
+			objects = append(objects, object)
+		}
+	})
+	return objects
+}
+
+// CheckColisionPoint reports whether subject lies within any object of the collision groups.
+// Maps without collision groups never collide.
+// Objects are looked up through the same spatial index as CheckColision.
+func (t *TmxMap) CheckColisionPoint(subject image.Point) bool {
+	index, objects := t.collisionIndex()
+	p := Point{X: float64(subject.X), Y: float64(subject.Y)}
+
+	return index.any(image.Rectangle{Min: subject, Max: subject}, func(i int) bool {
+		return objects[i].ContainsPoint(p)
+	})
 }
 
-func (t TmxMap) CheckColision(subject image.Rectangle) bool {
-	collisionLayer := t.GetObjectGroupByName("collisionmap")
+// CheckColision reports whether subject overlaps any object of the collision groups, see SetCollisionGroups.
+// Polygons and ellipses collide with their actual shape, not their bounding box.
+// Maps without collision groups never collide.
+// Objects are looked up through a spatial index built on first use, see InvalidateCollisionIndex.
+func (t *TmxMap) CheckColision(subject image.Rectangle) bool {
+	index, objects := t.collisionIndex()
 
-	for _, object := range collisionLayer.Objects {
-		if subject.Min.X < object.X+object.Width &&
-			subject.Min.X+subject.Max.X > object.X &&
-			subject.Min.Y < object.Y+object.Height &&
-			subject.Min.Y+subject.Max.Y > object.Y {
+	return index.any(subject, func(i int) bool {
+		return overlapsObject(subject, objects[i])
+	})
+}
+
+// CheckColisionInGroup reports whether subject overlaps any object of the named object group,
+// regardless of the configured collision groups. Returns false if the map has no such group.
+func (t *TmxMap) CheckColisionInGroup(subject image.Rectangle, groupName string) bool {
+	group := t.GetObjectGroupByName(groupName)
+	if group == nil {
+		return false
+	}
 
-			log.Debug().Msgf("Collision detected with %s [%d,%d][%d,%d]\n", object.Name, object.X, object.Y, object.Width, object.Height)
-			log.Debug().Msgf("%s\n", subject)
+	for _, object := range group.Objects {
+		if overlapsObject(subject, object) {
 			return true
 		}
 	}
 	return false
 }
 
-func LoadFromFile(path string) (*TmxMap, error) {
-	gameMap := &TmxMap{}
+// overlapsObject reports whether subject overlaps the object's shape. Polygons and ellipses are
+// tested against their outline, all other shapes against the object's rectangle.
+func overlapsObject(subject image.Rectangle, object *Object) bool {
+	switch object.Shape() {
+	case ShapePolygon:
+		_, ok := separate(rectPolygon(subject), object.worldPolygon())
+		return ok
+	case ShapeEllipse:
+		return overlapsEllipse(subject, object)
+	}
+	if subject.Min.X < object.X+object.Width &&
+		subject.Max.X > object.X &&
+		subject.Min.Y < object.Y+object.Height &&
+		subject.Max.Y > object.Y {
+
+		log.Debug().Msgf("Collision detected with %s [%d,%d][%d,%d]\n", object.Name, object.X, object.Y, object.Width, object.Height)
+		log.Debug().Msgf("%s\n", subject)
+		return true
+	}
+	return false
+}
+
+// TileAt returns the tile at the given cell of the named layer, nil if the cell is empty,
+// outside of the layer or there is no such layer
+func (t *TmxMap) TileAt(layerName string, x, y int) *Tile {
+	layer := t.GetLayerByName(layerName)
+	if layer == nil {
+		return nil
+	}
+	return layer.GetTileAt(x, y)
+}
+
+// TopTileAt returns the tile at the given cell of the topmost visible layer that isn't empty there,
+// along with that layer. Returns nil, nil if all visible layers are empty at the cell.
+func (t *TmxMap) TopTileAt(x, y int) (*Tile, *Layer) {
+	for i := len(t.Layers) - 1; i >= 0; i-- {
+		if !t.Layers[i].Visible {
+			continue
+		}
+		if tile := t.Layers[i].GetTileAt(x, y); tile != nil {
+			return tile, t.Layers[i]
+		}
+	}
+	return nil, nil
+}
+
+// ForEachCell calls fn for every cell within the Bounds of the named layer, iterating in the map's
+// render order. Empty cells are passed a nil tile.
+func (t *TmxMap) ForEachCell(layerName string, fn func(x, y int, tile *Tile)) {
+	layer := t.GetLayerByName(layerName)
+	if layer == nil {
+		return
+	}
+
+	layer.ensureDecoded()
+	bounds := layer.Bounds()
+	cells := make([]*Tile, bounds.Dx()*bounds.Dy())
+	for _, tile := range layer.Tiles {
+		if i, ok := cellIndex(bounds, tile.X, tile.Y); ok {
+			cells[i] = tile
+		}
+	}
+
+	up := t.Renderorder == RightUp || t.Renderorder == LeftUp
+	left := t.Renderorder == LeftDown || t.Renderorder == LeftUp
+	for row := 0; row < bounds.Dy(); row++ {
+		y := bounds.Min.Y + row
+		if up {
+			y = bounds.Max.Y - 1 - row
+		}
+		for col := 0; col < bounds.Dx(); col++ {
+			x := bounds.Min.X + col
+			if left {
+				x = bounds.Max.X - 1 - col
+			}
+			i, _ := cellIndex(bounds, x, y)
+			fn(x, y, cells[i])
+		}
+	}
+}
+
+// TilesInRegion returns per layer name the tiles whose cells intersect the given world rectangle.
+// Layers without tiles in the region are left out.
+func (t *TmxMap) TilesInRegion(region image.Rectangle) map[string][]*Tile {
+	result := make(map[string][]*Tile)
+	for _, layer := range t.Layers {
+		layer.ensureDecoded()
+		for _, tile := range layer.Tiles {
+			cell := image.Rect(tile.X*t.TileWidth, tile.Y*t.TileHeight, (tile.X+1)*t.TileWidth, (tile.Y+1)*t.TileHeight)
+			if cell.Overlaps(region) {
+				result[layer.Name] = append(result[layer.Name], tile)
+			}
+		}
+	}
+	return result
+}
+
+// SolidityMask returns a bit-packed grid of the named layer marking the cells for which isSolid
+// returns true. A nil isSolid treats every non-empty cell as solid.
+// The mask covers the layer's Bounds b, cell (x, y) is stored at index
+// i = (y-b.Min.Y)*b.Dx() + x-b.Min.X, in bit i%64 (least significant first) of word i/64.
+// For finite maps b is the layer size, so that's i = y*layer.Width + x.
+// Returns nil if the layer doesn't exist.
+func (t *TmxMap) SolidityMask(layerName string, isSolid func(*Tile) bool) []uint64 {
+	layer := t.GetLayerByName(layerName)
+	if layer == nil {
+		return nil
+	}
+
+	layer.ensureDecoded()
+	bounds := layer.Bounds()
+	mask := make([]uint64, (bounds.Dx()*bounds.Dy()+63)/64)
+	for _, tile := range layer.Tiles {
+		if isSolid != nil && !isSolid(tile) {
+			continue
+		}
+		i, ok := cellIndex(bounds, tile.X, tile.Y)
+		if !ok {
+			continue
+		}
+		mask[i/64] |= 1 << uint(i%64)
+	}
+	return mask
+}
+
+func LoadFromFile(path string, opts ...LoadOption) (*TmxMap, error) {
+	return loadFromFile(path, newLoadOptions(opts))
+}
 
-	data, err := ioutil.ReadFile(path)
+// Reload loads the map from path again and replaces the receiver's content with it,
+// keeping the load options, the camera, the animation clock and the collision groups.
+// Layers whose data didn't change keep their decoded tiles and rendered image as long as the map
+// references the same tilesets; call InvalidateAll afterwards if a tileset image changed.
+// All other cached renders are dropped.
+func (t *TmxMap) Reload(path string) error {
+	options := t.options
+	options.lazyDecode = true
+	reloaded, err := loadFromFile(path, options)
 	if err != nil {
-		return gameMap, err
+		return err
+	}
+	reloaded.options = t.options
+
+	// layers with unchanged data keep their tiles and rendered image
+	tilesets := t.tilesetMapping(reloaded)
+	for _, layer := range reloaded.Layers {
+		previous := t.previousLayer(layer)
+		if tilesets == nil || previous == nil || previous.pending != nil || previous.Tiles == nil || previous.dataHash != layer.dataHash {
+			continue
+		}
+		for _, tile := range previous.Tiles {
+			tile.Tileset = tilesets[tile.Tileset]
+			tile.layer = layer
+		}
+		layer.Tiles = previous.Tiles
+		layer.grid = previous.grid
+		layer.Rendered = previous.Rendered
+		layer.renderedVisible = previous.renderedVisible
+		layer.animated = previous.animated
+		layer.renderedAt = previous.renderedAt
+		layer.dirty = previous.dirty
+		layer.pending = nil
+		previous.Rendered = nil
 	}
 
-	err = xml.Unmarshal([]byte(data), &gameMap)
+	t.InvalidateAll()
+	reloaded.CameraPosition = t.CameraPosition
+	reloaded.CameraOffset = t.CameraOffset
+	reloaded.CameraBounds = t.CameraBounds
+	reloaded.ScaledCam = t.ScaledCam
+	reloaded.animationTime = t.animationTime
+	reloaded.collisionGroups = t.collisionGroups
+	*t = *reloaded
+
+	for _, layer := range t.Layers {
+		if layer.pending == nil {
+			continue
+		}
+		layer.pending = t
+		if t.options.lazyDecode {
+			continue
+		}
+		layer.pending = nil
+		if err := layer.DecodeData(t); err != nil {
+			return err
+		}
+	}
+
+	// the layers were loaded lazily, so the tiles are counted once all are in place
+	if stats := t.options.stats; stats != nil {
+		stats.Tiles = 0
+		for _, layer := range t.Layers {
+			if layer.pending == nil {
+				stats.Tiles += len(layer.Tiles)
+			}
+		}
+	}
+	return nil
+}
+
+// previousLayer returns the layer of t matching the given reloaded layer by id, or by name for layers without id
+func (t *TmxMap) previousLayer(layer *Layer) *Layer {
+	for _, previous := range t.Layers {
+		if layer.ID != 0 && previous.ID == layer.ID {
+			return previous
+		}
+		if layer.ID == 0 && previous.ID == 0 && previous.Name == layer.Name {
+			return previous
+		}
+	}
+	return nil
+}
+
+// tilesetMapping maps the tilesets of t to the ones of reloaded
+// Returns nil if the maps don't reference the same tilesets, in which case decoded tiles can't be reused
+func (t *TmxMap) tilesetMapping(reloaded *TmxMap) map[*Tileset]*Tileset {
+	if len(t.Tilesets) != len(reloaded.Tilesets) {
+		return nil
+	}
+	mapping := make(map[*Tileset]*Tileset)
+	for i, tileset := range t.Tilesets {
+		if tileset.FirstGid != reloaded.Tilesets[i].FirstGid || tileset.Source != reloaded.Tilesets[i].Source {
+			return nil
+		}
+		mapping[tileset] = reloaded.Tilesets[i]
+	}
+	if t.placeholder != nil {
+		mapping[t.placeholder] = reloaded.placeholderTileset()
+	}
+	return mapping
+}
+
+func loadFromFile(path string, options loadOptions) (*TmxMap, error) {
+	data, err := readFile(options.fsys, path)
 	if err != nil {
 		return nil, err
 	}
+	return loadMap(data, fileDir(options.fsys, path), options)
+}
 
+// loadMap parses the map data and loads everything it references relative to dir
+func loadMap(data []byte, dir string, options loadOptions) (*TmxMap, error) {
+	gameMap := &TmxMap{options: options}
+	stats := gameMap.options.stats
+	if stats == nil {
+		stats = &LoadStats{}
+	}
+	// the stats of a previous load, e.g. before Reload, are replaced
+	*stats = LoadStats{}
+	loadStart := time.Now()
+
+	err := xml.Unmarshal(data, &gameMap)
+	if err != nil {
+		return nil, err
+	}
+	stats.XMLParse = time.Since(loadStart)
+
+	tilesetStart := time.Now()
 	for i := range gameMap.Tilesets {
-		err := gameMap.Tilesets[i].LoadFromTsx(filepath.Dir(path))
+		gameMap.Tilesets[i].sourceResolver = gameMap.options.sourceResolver
+		gameMap.Tilesets[i].fsys = gameMap.options.fsys
+		gameMap.Tilesets[i].maxDecompressedSize = gameMap.options.maxDecompressedSize
+		if gameMap.Tilesets[i].FirstGid == 0 {
+			return nil, fmt.Errorf("tileset %s has invalid firstgid 0", gameMap.Tilesets[i].describe(i))
+		}
+		err := gameMap.Tilesets[i].LoadFromTsx(dir)
 		if err != nil {
 			return nil, err
 		}
+		stats.ImageDecode += gameMap.Tilesets[i].imageDecodeTime
 	}
+	stats.TilesetLoad = time.Since(tilesetStart) - stats.ImageDecode
+	stats.Tilesets = len(gameMap.Tilesets)
 
+	layerStart := time.Now()
 	for i := range gameMap.Layers {
+		if gameMap.options.lazyDecode {
+			gameMap.Layers[i].pending = gameMap
+			continue
+		}
 		err := gameMap.Layers[i].DecodeData(gameMap)
 		if err != nil {
 			return nil, err
 		}
+		stats.Tiles += len(gameMap.Layers[i].Tiles)
 	}
+	stats.LayerDecode = time.Since(layerStart)
 
+	for _, layer := range gameMap.ImageLayers {
+		if layer.Image == nil || (layer.Image.Source == "" && layer.Image.Data == nil) {
+			continue
+		}
+		layer.EbitenImage, _, err = layer.Image.load(gameMap.options.fsys, dir, gameMap.options.maxDecompressedSize)
+		if err != nil {
+			return nil, fmt.Errorf("image layer '%s': %w", layer.Name, err)
+		}
+	}
+
+	templates := &templateLoader{gameMap: gameMap, dir: dir, templates: make(map[string]*Template)}
 	for _, og := range gameMap.ObjectGroups {
-		log.Debug().Msgf("Objectgroup: '%s' with %d objects\n", og.Name, len(og.Objects))
+		for _, object := range og.Objects {
+			if err := templates.apply(object); err != nil {
+				return nil, err
+			}
+			if object.Gid == 0 {
+				continue
+			}
+			tile := TileFromGID(object.Gid)
+			tile.Tileset = gameMap.TilesetForGID(tile.GlobalTileID)
+			if tile.Tileset == nil {
+				return nil, fmt.Errorf("couldn't find tileset for object %d with gid %d", object.ID, tile.GlobalTileID)
+			}
+			tile.InternalTileID = tile.GlobalTileID - tile.Tileset.FirstGid
+			object.Tile = tile
+		}
 	}
-	for i, object := range gameMap.ObjectGroups[0].Objects {
-		log.Debug().Msgf("Object #%d: %s [%d/%d, %d/%d]\n", i, object.Name, object.X, object.Y, object.Width, object.Height)
+
+	for _, og := range gameMap.ObjectGroups {
+		log.Debug().Msgf("Objectgroup: '%s' with %d objects\n", og.Name, len(og.Objects))
+		for i, object := range og.Objects {
+			log.Debug().Msgf("Object #%d: %s [%d/%d, %d/%d]\n", i, object.Name, object.X, object.Y, object.Width, object.Height)
+		}
 	}
 
-	gameMap.PixelWidth = gameMap.Width * gameMap.TileWidth
-	gameMap.PixelHeight = gameMap.Height * gameMap.TileHeight
+	gameMap.PixelWidth, gameMap.PixelHeight = gameMap.pixelSize()
+
+	stats.Total = time.Since(loadStart)
 
 	return gameMap, nil
 }
+
+// LoadDir loads every .tmx file in dir, keyed by the file name without extension.
+// Maps that fail to load are left out and their errors combined into the returned error.
+func LoadDir(dir string, opts ...LoadOption) (map[string]*TmxMap, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmx"))
+	if err != nil {
+		return nil, err
+	}
+
+	maps := make(map[string]*TmxMap)
+	var failed []string
+	for _, file := range files {
+		gameMap, err := LoadFromFile(file, opts...)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", file, err))
+			continue
+		}
+		maps[strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))] = gameMap
+	}
+
+	if len(failed) > 0 {
+		return maps, errors.New("failed loading maps: " + strings.Join(failed, "; "))
+	}
+	return maps, nil
+}
@@ -0,0 +1,1081 @@
+package ebitmx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCameraOffset(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(8, 8, csvLayer(1, "ground", 8, 8, make([]uint32, 64)...)))
+	gameMap.CameraBounds = image.Rect(0, 0, 40, 30)
+	gameMap.CameraPosition = image.Pt(64, 64)
+
+	without := gameMap.UpdateScaledCam(1)
+	gameMap.CameraOffset = image.Pt(3, -2)
+	with := gameMap.UpdateScaledCam(1)
+
+	if want := without.Add(image.Pt(3, -2)); with != want {
+		t.Errorf("camera view with offset is %v, want %v", with, want)
+	}
+	if gameMap.CameraPosition != image.Pt(64, 64) {
+		t.Errorf("CameraPosition changed to %v", gameMap.CameraPosition)
+	}
+	if got := gameMap.Layers[0].Render(gameMap, 1, false).Bounds(); got != with {
+		t.Errorf("rendered layer view is %v, want %v", got, with)
+	}
+}
+
+func TestLayerStackOrder(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(1, 1, csvLayer(1, "ground", 1, 1, 1)+` <objectgroup id="2" name="spawns"/>
+`+csvLayer(3, "walls", 1, 1, 2)+` <objectgroup id="4" name="items"/>
+`))
+
+	want := []struct {
+		name  string
+		layer *Layer
+		group *ObjectGroup
+	}{
+		{"ground", gameMap.Layers[0], nil},
+		{"spawns", nil, gameMap.ObjectGroups[0]},
+		{"walls", gameMap.Layers[1], nil},
+		{"items", nil, gameMap.ObjectGroups[1]},
+	}
+	if len(gameMap.LayerStack) != len(want) {
+		t.Fatalf("layer stack has %d entries, want %d", len(gameMap.LayerStack), len(want))
+	}
+	for i, entry := range gameMap.LayerStack {
+		if entry.Name() != want[i].name || entry.Layer != want[i].layer || entry.ObjectGroup != want[i].group {
+			t.Errorf("entry %d is %s, want %s", i, entry.Name(), want[i].name)
+		}
+	}
+}
+
+func TestLayersByClass(t *testing.T) {
+	empty := make([]uint32, 4)
+	tmx := testTMX(2, 2, strings.Join([]string{
+		strings.Replace(csvLayer(1, "walls", 2, 2, empty...), `name="walls"`, `name="walls" class="solid"`, 1),
+		csvLayer(2, "floor", 2, 2, empty...),
+		strings.Replace(csvLayer(3, "rocks", 2, 2, empty...), `name="rocks"`, `name="rocks" class="solid"`, 1),
+	}, ""))
+	gameMap := loadTestMap(t, tmx)
+
+	layers := gameMap.LayersByClass("solid")
+	if len(layers) != 2 || layers[0].Name != "walls" || layers[1].Name != "rocks" {
+		t.Fatalf("LayersByClass returned %d layers, want walls and rocks", len(layers))
+	}
+	if gameMap.Layers[1].Class != "" {
+		t.Errorf("floor has class '%s'", gameMap.Layers[1].Class)
+	}
+	if layers := gameMap.LayersByClass("missing"); layers != nil {
+		t.Errorf("LayersByClass of a missing class returned %d layers", len(layers))
+	}
+}
+
+func TestRawGIDs(t *testing.T) {
+	gid := 3 | FLIPPED_HORIZONTALLY_FLAG | FLIPPED_DIAGONALLY_FLAG
+	tmx := testTMX(2, 1, csvLayer(1, "ground", 2, 1, gid, 0))
+
+	raw := loadTestMap(t, tmx, WithRawGIDs()).Layers[0].Tiles[0]
+	if raw.GlobalTileID != gid || raw.GID() != gid {
+		t.Errorf("raw tile has gid %#x, want %#x", raw.GlobalTileID, gid)
+	}
+	if raw.InternalTileID != 2 || raw.FlippedHorizontally || raw.FlippedDiagonally {
+		t.Errorf("raw tile resolved to internal id %d with flips %v/%v, want 2 unflipped", raw.InternalTileID, raw.FlippedHorizontally, raw.FlippedDiagonally)
+	}
+
+	decoded := loadTestMap(t, tmx).Layers[0].Tiles[0]
+	if decoded.GlobalTileID != 3 || !decoded.FlippedHorizontally || !decoded.FlippedDiagonally || decoded.GID() != gid {
+		t.Errorf("decoded tile has gid %d and flips %v/%v", decoded.GlobalTileID, decoded.FlippedHorizontally, decoded.FlippedDiagonally)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	tests := []struct {
+		h, v, d  bool
+		rotation int
+		mirrored bool
+	}{
+		{false, false, false, 0, false},
+		{true, false, false, 0, true},
+		{false, true, false, 180, true},
+		{true, true, false, 180, false},
+		{false, false, true, 270, true},
+		{true, false, true, 90, false},
+		{false, true, true, 270, false},
+		{true, true, true, 90, true},
+	}
+	for _, test := range tests {
+		tile := &Tile{FlippedHorizontally: test.h, FlippedVertically: test.v, FlippedDiagonally: test.d}
+		if got := tile.Rotation(); got != test.rotation {
+			t.Errorf("h=%v v=%v d=%v: rotation %d, want %d", test.h, test.v, test.d, got, test.rotation)
+		}
+		if got := tile.Mirrored(); got != test.mirrored {
+			t.Errorf("h=%v v=%v d=%v: mirrored %v, want %v", test.h, test.v, test.d, got, test.mirrored)
+		}
+	}
+}
+
+func TestObjectTileProperties(t *testing.T) {
+	fsys := newTestFS(testTMX(2, 2, ` <objectgroup id="2" name="objects">
+  <object id="1" gid="3" x="0" y="16" width="16" height="16">
+   <properties>
+    <property name="locked" value="true"/>
+   </properties>
+  </object>
+  <object id="2" gid="3" x="16" y="16" width="16" height="16">
+   <properties>
+    <property name="kind" value="gate"/>
+   </properties>
+  </object>
+ </objectgroup>
+`))
+	fsys["tiles.tsx"].Data = []byte(testTSX(` <tile id="2">
+  <properties>
+   <property name="kind" value="door"/>
+  </properties>
+ </tile>
+`))
+	gameMap := loadTestMapFS(t, fsys)
+
+	door := gameMap.GetObjectByID(1)
+	if kind, ok := door.GetStringProperty("kind"); !ok || kind != "door" {
+		t.Errorf("object inherited kind '%s' (%v), want door", kind, ok)
+	}
+	if locked, ok := door.GetStringProperty("locked"); !ok || locked != "true" {
+		t.Errorf("object's own property is '%s' (%v)", locked, ok)
+	}
+	if kind, _ := gameMap.GetObjectByID(2).GetStringProperty("kind"); kind != "gate" {
+		t.Errorf("object property '%s' didn't override the tile's", kind)
+	}
+	if _, ok := door.GetStringProperty("missing"); ok {
+		t.Error("found a missing property")
+	}
+}
+
+func TestVisibleTileRange(t *testing.T) {
+	gameMap := &TmxMap{Width: 10, Height: 10, TileWidth: 16, TileHeight: 16, CameraBounds: image.Rect(0, 0, 64, 48)}
+	tests := []struct {
+		position image.Point
+		scale    float64
+		want     image.Rectangle
+	}{
+		{image.Pt(80, 80), 1, image.Rect(3, 3, 6, 6)},
+		{image.Pt(80, 80), 2, image.Rect(4, 4, 5, 5)},
+		{image.Pt(0, 0), 1, image.Rect(0, 0, 1, 1)},
+		{image.Pt(0, 0), 2, image.Rect(0, 0, 0, 0)},
+		{image.Pt(160, 160), 1, image.Rect(8, 8, 9, 9)},
+		{image.Pt(160, 160), 2, image.Rect(9, 9, 9, 9)},
+	}
+	for _, test := range tests {
+		gameMap.CameraPosition = test.position
+		if got := gameMap.VisibleTileRange(test.scale); got != test.want {
+			t.Errorf("camera at %v scale %g: visible range %v, want %v", test.position, test.scale, got, test.want)
+		}
+	}
+
+	gameMap.CameraPosition = image.Pt(400, 400)
+	if got := gameMap.VisibleTileRange(1); got.Max.X >= got.Min.X {
+		t.Errorf("camera outside of the map: visible range %v isn't empty", got)
+	}
+}
+
+func TestObjectGroupParallax(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(20, 20, ` <objectgroup id="1" name="near">
+  <object id="1" x="16" y="16" width="16" height="16"/>
+ </objectgroup>
+ <objectgroup id="2" name="far" parallaxx="0.5" parallaxy="0.25">
+  <object id="2" x="16" y="16" width="16" height="16"/>
+ </objectgroup>
+`))
+	gameMap.CameraBounds = image.Rect(0, 0, 64, 64)
+	near, far := gameMap.GetObjectGroupByName("near"), gameMap.GetObjectGroupByName("far")
+
+	gameMap.CameraPosition = image.Pt(200, 200)
+	nearBefore, farBefore := near.DebugRender(gameMap, 1).Bounds(), far.DebugRender(gameMap, 1).Bounds()
+	gameMap.CameraPosition = image.Pt(240, 280)
+	nearAfter, farAfter := near.DebugRender(gameMap, 1).Bounds(), far.DebugRender(gameMap, 1).Bounds()
+
+	if shift := nearAfter.Min.Sub(nearBefore.Min); shift != image.Pt(40, 80) {
+		t.Errorf("group without parallax shifted by %v, want (40,80)", shift)
+	}
+	if shift := farAfter.Min.Sub(farBefore.Min); shift != image.Pt(20, 20) {
+		t.Errorf("parallaxed group shifted by %v, want (20,20)", shift)
+	}
+}
+
+func TestSolidityMask(t *testing.T) {
+	gids := make([]uint32, 10*7)
+	gids[0] = 1
+	gids[2*10+3] = 2
+	gids[6*10+9] = 5
+	gameMap := loadTestMap(t, testTMX(10, 7, csvLayer(1, "walls", 10, 7, gids...)))
+
+	solid := func(mask []uint64, x, y int) bool {
+		i := y*10 + x
+		return mask[i/64]&(1<<uint(i%64)) != 0
+	}
+	mask := gameMap.SolidityMask("walls", nil)
+	if len(mask) != 2 {
+		t.Fatalf("mask has %d words, want 2", len(mask))
+	}
+	for _, cell := range []image.Point{{0, 0}, {3, 2}, {9, 6}} {
+		if !solid(mask, cell.X, cell.Y) {
+			t.Errorf("cell %v isn't solid", cell)
+		}
+	}
+	for _, cell := range []image.Point{{1, 0}, {2, 2}, {8, 6}} {
+		if solid(mask, cell.X, cell.Y) {
+			t.Errorf("empty cell %v is solid", cell)
+		}
+	}
+
+	mask = gameMap.SolidityMask("walls", func(tile *Tile) bool { return tile.InternalTileID == 4 })
+	if solid(mask, 0, 0) || solid(mask, 3, 2) || !solid(mask, 9, 6) {
+		t.Error("predicate wasn't applied")
+	}
+	if gameMap.SolidityMask("missing", nil) != nil {
+		t.Error("mask of a missing layer isn't nil")
+	}
+}
+
+func TestFirstGidZero(t *testing.T) {
+	tmx := strings.Replace(testTMX(1, 1, csvLayer(1, "ground", 1, 1, 1)), `firstgid="1"`, `firstgid="0"`, 1)
+	_, err := LoadFromFS(newTestFS(tmx), "map.tmx")
+	if err == nil || !strings.Contains(err.Error(), "firstgid 0") {
+		t.Errorf("loading a tileset with firstgid 0 returned %v", err)
+	}
+
+	gameMap := &TmxMap{Tilesets: []*Tileset{{Source: "tiles.tsx"}}}
+	if err := gameMap.Validate(); err == nil || !strings.Contains(err.Error(), "firstgid 0") {
+		t.Errorf("validating a tileset with firstgid 0 returned %v", err)
+	}
+
+	// inline tilesets have no source to name
+	inline := strings.Replace(tmx, `<tileset firstgid="0" source="tiles.tsx"/>`, `<tileset firstgid="0" name="terrain" tilewidth="16" tileheight="16" tilecount="16" columns="4"/>`, 1)
+	_, err = LoadFromFS(newTestFS(inline), "map.tmx")
+	if err == nil || !strings.Contains(err.Error(), "tileset 'terrain' has invalid firstgid 0") {
+		t.Errorf("loading an inline tileset with firstgid 0 returned %v", err)
+	}
+	gameMap = &TmxMap{Tilesets: []*Tileset{{FirstGid: 1, TileCount: 4}, {}}}
+	if err := gameMap.Validate(); err == nil || !strings.Contains(err.Error(), "tileset #1 has invalid firstgid 0") {
+		t.Errorf("validating an unnamed tileset with firstgid 0 returned %v", err)
+	}
+}
+
+func TestTilesInRegion(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(4, 2, csvLayer(1, "ground", 4, 2,
+		1, 2, 3, 4,
+		5, 6, 7, 8,
+	)+csvLayer(2, "decor", 4, 2,
+		0, 0, 0, 0,
+		0, 0, 9, 0,
+	)+csvLayer(3, "empty", 4, 2, make([]uint32, 8)...)))
+
+	result := gameMap.TilesInRegion(image.Rect(16, 16, 40, 32))
+	if len(result) != 2 {
+		t.Fatalf("found tiles on %d layers, want 2", len(result))
+	}
+	if ground := result["ground"]; len(ground) != 2 || ground[0].GlobalTileID != 6 || ground[1].GlobalTileID != 7 {
+		t.Errorf("found %d ground tiles, want gids 6 and 7", len(ground))
+	}
+	if decor := result["decor"]; len(decor) != 1 || decor[0].GlobalTileID != 9 {
+		t.Errorf("found %d decor tiles, want gid 9", len(decor))
+	}
+
+	// rectangles touching a cell's edge don't intersect it
+	if ground := gameMap.TilesInRegion(image.Rect(0, 0, 16, 16))["ground"]; len(ground) != 1 {
+		t.Errorf("region of the first cell intersects %d ground tiles", len(ground))
+	}
+}
+
+// chunkedTMX is an infinite map with two 2x2 chunks, one of them at negative cells
+var chunkedTMX = strings.Replace(testTMX(4, 4, ` <layer id="1" name="ground" width="4" height="4">
+  <data encoding="csv">
+   <chunk x="2" y="0" width="2" height="2">
+5,6,
+7,8
+</chunk>
+   <chunk x="-2" y="-1" width="2" height="2">
+1,2,
+3,0
+</chunk>
+  </data>
+ </layer>
+`), `infinite="0"`, `infinite="1"`, 1)
+
+func TestGetTileAt(t *testing.T) {
+	for _, opts := range [][]LoadOption{nil, {WithTileGrid()}} {
+		narrow := loadTestMap(t, testTMX(4, 2, csvLayer(1, "narrow", 2, 2, 1, 2, 3, 4)), opts...).Layers[0]
+		if tile := narrow.GetTileAt(1, 1); tile == nil || tile.GlobalTileID != 4 {
+			t.Errorf("narrow layer: cell 1,1 has tile %v, want gid 4", tile)
+		}
+		for _, cell := range []image.Point{{2, 0}, {3, 1}, {-1, 0}, {0, 2}} {
+			if tile := narrow.GetTileAt(cell.X, cell.Y); tile != nil {
+				t.Errorf("narrow layer: cell %v outside of the layer has gid %d", cell, tile.GlobalTileID)
+			}
+		}
+
+		chunked := loadTestMap(t, chunkedTMX, opts...).Layers[0]
+		if bounds := chunked.Bounds(); bounds != image.Rect(-2, -1, 4, 2) {
+			t.Errorf("chunked layer has bounds %v", bounds)
+		}
+		for _, cell := range []struct {
+			x, y int
+			gid  uint32
+		}{{-2, -1, 1}, {-1, 0, 0}, {-2, 0, 3}, {3, 1, 8}, {2, 0, 5}, {0, 0, 0}, {4, 0, 0}} {
+			var gid uint32
+			if tile := chunked.GetTileAt(cell.x, cell.y); tile != nil {
+				gid = tile.GlobalTileID
+			}
+			if gid != cell.gid {
+				t.Errorf("chunked layer: cell %d,%d has gid %d, want %d", cell.x, cell.y, gid, cell.gid)
+			}
+		}
+	}
+}
+
+func BenchmarkGetTileAt(b *testing.B) {
+	const size = 128
+	gids := make([]uint32, size*size)
+	for i := range gids {
+		gids[i] = uint32(i%2) * 3
+	}
+	tmx := testTMX(size, size, csvLayer(1, "ground", size, size, gids...))
+
+	for _, bench := range []struct {
+		name string
+		opts []LoadOption
+	}{
+		{"slice", nil},
+		{"grid", []LoadOption{WithTileGrid()}},
+	} {
+		layer := loadTestMap(b, tmx, bench.opts...).Layers[0]
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				layer.GetTileAt(i%size, (i/size)%size)
+			}
+		})
+	}
+}
+
+func TestChunkedTilesSorted(t *testing.T) {
+	// the chunk at 2,0 comes first in the document but the tiles are in row-major order
+	layer := loadTestMap(t, chunkedTMX).Layers[0]
+	want := []image.Point{{-2, -1}, {-1, -1}, {-2, 0}, {2, 0}, {3, 0}, {2, 1}, {3, 1}}
+	got := tilePositions(layer.Tiles)
+	if len(got) != len(want) {
+		t.Fatalf("decoded tiles at %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("decoded tiles at %v, want %v", got, want)
+		}
+	}
+}
+
+func TestChunkedLayerCells(t *testing.T) {
+	gameMap := loadTestMap(t, chunkedTMX)
+	layer := gameMap.Layers[0]
+
+	// the chunks span the cells -2,-1 to 3,1
+	wantGIDs := []uint32{
+		1, 2, 0, 0, 0, 0,
+		3, 0, 0, 0, 5, 6,
+		0, 0, 0, 0, 7, 8,
+	}
+	if gids := layer.RawGIDs(); !equalGIDs(gids, wantGIDs) {
+		t.Errorf("RawGIDs() = %v, want %v", gids, wantGIDs)
+	}
+	grid := layer.TileGrid()
+	if len(grid) != 3 || len(grid[0]) != 6 || grid[0][0] != 1 || grid[1][0] != 3 || grid[2][5] != 8 {
+		t.Errorf("TileGrid() = %v", grid)
+	}
+	mask := gameMap.SolidityMask("ground", nil)
+	for i, gid := range wantGIDs {
+		if solid := mask[i/64]&(1<<uint(i%64)) != 0; solid != (gid != 0) {
+			t.Errorf("SolidityMask: cell %d,%d solid = %t", i%6-2, i/6-1, solid)
+		}
+	}
+
+	var cells []string
+	gameMap.ForEachCell("ground", func(x, y int, tile *Tile) {
+		if tile != nil {
+			cells = append(cells, fmt.Sprintf("%d,%d:%d", x, y, tile.GlobalTileID))
+		}
+	})
+	if got, want := strings.Join(cells, " "), "-2,-1:1 -1,-1:2 -2,0:3 2,0:5 3,0:6 2,1:7 3,1:8"; got != want {
+		t.Errorf("ForEachCell visited %s, want %s", got, want)
+	}
+
+	csv, err := layer.EncodeData(CSV, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\n1,2,0,0,0,0,\n3,0,0,0,5,6,\n0,0,0,0,7,8\n"; csv != want {
+		t.Errorf("EncodeData(CSV) = %q, want %q", csv, want)
+	}
+
+	if !gameMap.PixelCollisionAt("ground", image.Pt(-20, -10), 128) {
+		t.Error("pixel -20,-10 of the tile at cell -2,-1 isn't solid")
+	}
+	if gameMap.PixelCollisionAt("ground", image.Pt(-10, 5), 128) {
+		t.Error("pixel -10,5 of the empty cell -1,0 is solid")
+	}
+
+	if err := layer.SetTile(gameMap, -1, 0, 4); err != nil {
+		t.Fatal(err)
+	}
+	if tile := layer.GetTileAt(-1, 0); tile == nil || tile.GlobalTileID != 4 {
+		t.Errorf("cell -1,0 has tile %v after SetTile, want gid 4", tile)
+	}
+	if err := layer.SetTile(gameMap, 4, 0, 4); err == nil {
+		t.Error("SetTile outside of the chunks succeeded")
+	}
+}
+
+func TestOverlayChunkedLayer(t *testing.T) {
+	gameMap := NewMap(4, 4, testTileSize, testTileSize)
+	gameMap.AddTileset(testTileset())
+	if err := gameMap.Overlay(loadTestMap(t, chunkedTMX)); err != nil {
+		t.Fatal(err)
+	}
+
+	layer := gameMap.Layers[0]
+	if len(layer.Data.Chunks) != 1 {
+		t.Fatalf("overlaid layer has %d chunks, want 1", len(layer.Data.Chunks))
+	}
+	if bounds := layer.Bounds(); bounds != image.Rect(-2, -1, 4, 2) {
+		t.Errorf("overlaid layer has bounds %v", bounds)
+	}
+	// the tileset of the overlaid map is added again, so only the internal ids are kept
+	for _, cell := range []struct {
+		x, y int
+		id   uint32
+	}{{-2, -1, 0}, {-1, -1, 1}, {-2, 0, 2}, {3, 1, 7}} {
+		if tile := layer.GetTileAt(cell.x, cell.y); tile == nil || tile.InternalTileID != cell.id {
+			t.Errorf("cell %d,%d has tile %v, want internal id %d", cell.x, cell.y, tile, cell.id)
+		}
+	}
+}
+
+func TestForEachCell(t *testing.T) {
+	tests := []struct {
+		order RenderOrder
+		want  string
+	}{
+		{RightDown, "0,0:1 1,0:0 0,1:3 1,1:4"},
+		{RightUp, "0,1:3 1,1:4 0,0:1 1,0:0"},
+		{LeftDown, "1,0:0 0,0:1 1,1:4 0,1:3"},
+		{LeftUp, "1,1:4 0,1:3 1,0:0 0,0:1"},
+	}
+	for _, test := range tests {
+		tmx := strings.Replace(testTMX(2, 2, csvLayer(1, "ground", 2, 2, 1, 0, 3, 4)), "right-down", string(test.order), 1)
+		gameMap := loadTestMap(t, tmx)
+
+		var cells []string
+		gameMap.ForEachCell("ground", func(x, y int, tile *Tile) {
+			var gid uint32
+			if tile != nil {
+				gid = tile.GlobalTileID
+			}
+			cells = append(cells, fmt.Sprintf("%d,%d:%d", x, y, gid))
+		})
+		if got := strings.Join(cells, " "); got != test.want {
+			t.Errorf("%s: visited %s, want %s", test.order, got, test.want)
+		}
+	}
+}
+
+func TestAbsoluteImageSource(t *testing.T) {
+	images := writeTestFiles(t, fstest.MapFS{"atlas/tiles.png": newTestFS("")["tiles.png"]})
+	absolute := filepath.Join(images, "atlas", "tiles.png")
+
+	fsys := newTestFS(testTMX(1, 1, csvLayer(1, "ground", 1, 1, 2)))
+	fsys["tiles.tsx"].Data = []byte(strings.Replace(testTSX(""), `source="tiles.png"`, `source="`+absolute+`"`, 1))
+	delete(fsys, "tiles.png")
+	dir := writeTestFiles(t, fsys)
+
+	gameMap, err := LoadFromFile(filepath.Join(dir, "map.tmx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gameMap.Tilesets[0].Tiles) != testTileCount {
+		t.Errorf("tileset has %d tiles", len(gameMap.Tilesets[0].Tiles))
+	}
+	if got := resolvePath(dir, absolute); got != absolute {
+		t.Errorf("absolute path resolved to %s", got)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	fsys := newTestFS("")
+	delete(fsys, "map.tmx")
+	fsys["first.tmx"] = &fstest.MapFile{Data: []byte(testTMX(1, 1, csvLayer(1, "ground", 1, 1, 1)))}
+	fsys["second.tmx"] = &fstest.MapFile{Data: []byte(testTMX(2, 1, csvLayer(1, "ground", 2, 1, 1, 2)))}
+	fsys["notes.txt"] = &fstest.MapFile{Data: []byte("not a map")}
+	dir := writeTestFiles(t, fsys)
+
+	maps, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(maps) != 2 || maps["first"] == nil || maps["second"] == nil || maps["second"].Width != 2 {
+		t.Errorf("loaded %d maps, want first and second", len(maps))
+	}
+
+	fsys["broken.tmx"] = &fstest.MapFile{Data: []byte("<map")}
+	maps, err = LoadDir(writeTestFiles(t, fsys))
+	if err == nil || !strings.Contains(err.Error(), "broken.tmx") {
+		t.Errorf("loading a directory with a broken map returned %v", err)
+	}
+	if len(maps) != 2 {
+		t.Errorf("loaded %d maps besides the broken one, want 2", len(maps))
+	}
+}
+
+func TestDecodeGID(t *testing.T) {
+	for _, h := range []bool{false, true} {
+		for _, v := range []bool{false, true} {
+			for _, d := range []bool{false, true} {
+				gid := uint32(42)
+				if h {
+					gid |= FLIPPED_HORIZONTALLY_FLAG
+				}
+				if v {
+					gid |= FLIPPED_VERTICALLY_FLAG
+				}
+				if d {
+					gid |= FLIPPED_DIAGONALLY_FLAG
+				}
+
+				id, flags := DecodeGID(gid)
+				if id != 42 || flags.Horizontal() != h || flags.Vertical() != v || flags.Diagonal() != d {
+					t.Errorf("gid %#x decoded to %d with flags h=%v v=%v d=%v", gid, id, flags.Horizontal(), flags.Vertical(), flags.Diagonal())
+				}
+				if tile := TileFromGID(gid); tile.GlobalTileID != 42 || tile.GID() != gid {
+					t.Errorf("tile of gid %#x encodes back to %#x", gid, tile.GID())
+				}
+			}
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := writeTestFiles(t, newTestFS(testTMX(2, 1, csvLayer(1, "ground", 2, 1, 1, 2))))
+	path := filepath.Join(dir, "map.tmx")
+	gameMap, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameMap.CameraPosition = image.Pt(5, 7)
+	gameMap.SetCollisionGroups("walls")
+
+	if err := os.WriteFile(path, []byte(testTMX(3, 1, csvLayer(1, "ground", 3, 1, 1, 4, 5))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := gameMap.Reload(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if gameMap.Width != 3 || gameMap.TileAt("ground", 1, 0).GlobalTileID != 4 || gameMap.TileAt("ground", 2, 0) == nil {
+		t.Errorf("reloaded map wasn't updated, width %d", gameMap.Width)
+	}
+	if gameMap.CameraPosition != image.Pt(5, 7) || len(gameMap.collisionGroups) != 1 {
+		t.Errorf("reload lost the camera %v or collision groups %v", gameMap.CameraPosition, gameMap.collisionGroups)
+	}
+}
+
+func TestImageCollectionTileset(t *testing.T) {
+	solid := func(w, h int, c color.RGBA) []byte {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		return encodePNG(img)
+	}
+	red, blue := color.RGBA{R: 0xff, A: 0xff}, color.RGBA{B: 0xff, A: 0xff}
+	fsys := newTestFS(testTMX(2, 2, csvLayer(1, "ground", 2, 2, 0, 0, 1, 4)))
+	fsys["tiles.tsx"].Data = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.8" tiledversion="1.8.2" name="objects" tilewidth="32" tileheight="24" tilecount="2" columns="0">
+ <grid orientation="isometric" width="32" height="16"/>
+ <tile id="0">
+  <image width="32" height="24" source="images/tree.png"/>
+ </tile>
+ <tile id="3">
+  <image width="16" height="16" source="images/rock.png"/>
+ </tile>
+</tileset>
+`)
+	fsys["images/tree.png"] = &fstest.MapFile{Data: solid(32, 24, red)}
+	fsys["images/rock.png"] = &fstest.MapFile{Data: solid(16, 16, blue)}
+	gameMap := loadTestMapFS(t, fsys)
+
+	tileset := gameMap.Tilesets[0]
+	if tileset.Grid == nil || tileset.Grid.Orientation != Isometric || tileset.Grid.Width != 32 || tileset.Grid.Height != 16 {
+		t.Errorf("tileset grid is %+v", tileset.Grid)
+	}
+	if len(tileset.Tiles) != 2 || tileset.Tiles[0].Bounds().Dx() != 32 || tileset.Tiles[3].Bounds().Dx() != 16 {
+		t.Fatalf("collection has %d tiles", len(tileset.Tiles))
+	}
+	if gameMap.TilesetForGID(4) != tileset || gameMap.TilesetForGID(5) != nil {
+		t.Error("gids of the collection's sparse tile ids don't resolve")
+	}
+
+	// each tile is aligned to the bottom left of its cell by its own height
+	rendered := gameMap.Layers[0].render(gameMap, false)
+	for _, p := range []struct {
+		x, y int
+		want color.RGBA
+	}{{0, 8, red}, {15, 31, red}, {31, 8, red}, {0, 7, color.RGBA{}}, {31, 31, blue}, {16, 16, blue}} {
+		if got := pixelAt(rendered, p.x, p.y); got != p.want {
+			t.Errorf("pixel %d,%d has color %v, want %v", p.x, p.y, got, p.want)
+		}
+	}
+}
+
+func TestLazyDecode(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(2, 1,
+		csvLayer(1, "ground", 2, 1, 1, 2)+csvLayer(2, "walls", 2, 1, 3, 0)+csvLayer(3, "decoration", 2, 1, 0, 4),
+	), WithLazyDecode())
+
+	decoded := func() []string {
+		var names []string
+		for _, layer := range gameMap.Layers {
+			if layer.pending == nil {
+				names = append(names, layer.Name)
+			}
+		}
+		return names
+	}
+	if names := decoded(); len(names) != 0 {
+		t.Fatalf("layers %v decoded before use", names)
+	}
+
+	walls := gameMap.GetLayerByName("walls")
+	if len(walls.Tiles) != 0 || len(decoded()) != 0 {
+		t.Fatal("GetLayerByName decoded the layer")
+	}
+	if tile := walls.GetTileAt(0, 0); tile == nil || tile.GlobalTileID != 3 {
+		t.Fatalf("tile of the lazily decoded layer: %+v", tile)
+	}
+	if names := decoded(); len(names) != 1 || names[0] != "walls" {
+		t.Errorf("decoded layers %v, want only walls", names)
+	}
+}
+
+func TestVisibilityDefault(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(1, 1, ` <layer id="1" name="absent" width="1" height="1">
+  <data encoding="csv">1</data>
+ </layer>
+ <layer id="2" name="hidden" width="1" height="1" visible="0">
+  <data encoding="csv">1</data>
+ </layer>
+ <objectgroup id="3" name="absent">
+  <object id="1" name="absent" x="0" y="0"/>
+  <object id="2" name="hidden" x="0" y="0" visible="0"/>
+ </objectgroup>
+ <objectgroup id="4" name="hidden" visible="0"/>
+ <imagelayer id="5" name="absent"/>
+ <imagelayer id="6" name="hidden" visible="0"/>
+`))
+
+	check := func(element, name string, visible Visibility) {
+		t.Helper()
+		if want := Visibility(name == "absent"); visible != want {
+			t.Errorf("%s '%s': visible %t, want %t", element, name, visible, want)
+		}
+	}
+	for _, layer := range gameMap.Layers {
+		check("layer", layer.Name, layer.Visible)
+	}
+	for _, group := range gameMap.ObjectGroups {
+		check("object group", group.Name, group.Visible)
+	}
+	for _, object := range gameMap.ObjectGroups[0].Objects {
+		check("object", object.Name, object.Visible)
+	}
+	for _, layer := range gameMap.ImageLayers {
+		check("image layer", layer.Name, layer.Visible)
+	}
+	if len(gameMap.Layers)+len(gameMap.ObjectGroups)+len(gameMap.ObjectGroups[0].Objects)+len(gameMap.ImageLayers) != 8 {
+		t.Errorf("not all elements were loaded")
+	}
+}
+
+func TestCompressionlevelDefault(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(1, 1, csvLayer(1, "ground", 1, 1, 1)))
+	if gameMap.Compressionlevel != -1 {
+		t.Errorf("absent compressionlevel is %d, want -1", gameMap.Compressionlevel)
+	}
+
+	tmx := strings.Replace(testTMX(1, 1, csvLayer(1, "ground", 1, 1, 1)), `infinite="0"`, `infinite="0" compressionlevel="0"`, 1)
+	if gameMap := loadTestMap(t, tmx); gameMap.Compressionlevel != 0 {
+		t.Errorf("compressionlevel 0 is loaded as %d", gameMap.Compressionlevel)
+	}
+}
+
+func TestTileRect(t *testing.T) {
+	tileset := testTileset()
+	tests := []struct {
+		id   int
+		want image.Rectangle
+		ok   bool
+	}{
+		{0, image.Rect(0, 0, 16, 16), true},
+		{6, image.Rect(32, 16, 48, 32), true},
+		{15, image.Rect(48, 48, 64, 64), true},
+		{16, image.Rectangle{}, false},
+		{-1, image.Rectangle{}, false},
+	}
+	for _, test := range tests {
+		if got, ok := tileset.TileRect(test.id); got != test.want || ok != test.ok {
+			t.Errorf("TileRect(%d) = %v, %t, want %v, %t", test.id, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestTilesetSourceResolver(t *testing.T) {
+	tmx := strings.Replace(testTMX(1, 1, csvLayer(1, "ground", 1, 1, 1)), `source="tiles.tsx"`, `source="editor/tiles.tsx"`, 1)
+	fsys := newTestFS(tmx)
+	red := color.RGBA{R: 0xff, A: 0xff}
+	atlas := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.Draw(atlas, atlas.Bounds(), image.NewUniform(red), image.Point{}, draw.Src)
+	fsys["atlas.png"] = &fstest.MapFile{Data: encodePNG(atlas)}
+
+	var sources []string
+	gameMap := loadTestMapFS(t, fsys, WithTilesetSourceResolver(func(source string) string {
+		sources = append(sources, source)
+		if source == "tiles.png" {
+			return "atlas.png"
+		}
+		return strings.TrimPrefix(source, "editor/")
+	}))
+
+	if len(sources) != 2 || sources[0] != "editor/tiles.tsx" || sources[1] != "tiles.png" {
+		t.Errorf("resolver called with %v", sources)
+	}
+	if got := pixelAt(gameMap.Layers[0].render(gameMap, false), 8, 8); got != red {
+		t.Errorf("tile has color %v, want %v from the redirected image", got, red)
+	}
+}
+
+func TestTileAt(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(2, 2, csvLayer(1, "ground", 2, 2, 1, 0, 0, 4)))
+
+	if tile := gameMap.TileAt("ground", 1, 1); tile == nil || tile.GlobalTileID != 4 || tile.X != 1 || tile.Y != 1 {
+		t.Errorf("occupied cell 1,1 has tile %v, want gid 4", tile)
+	}
+	for _, cell := range []image.Point{{1, 0}, {0, 1}} {
+		if tile := gameMap.TileAt("ground", cell.X, cell.Y); tile != nil {
+			t.Errorf("empty cell %v has gid %d", cell, tile.GlobalTileID)
+		}
+	}
+	for _, cell := range []image.Point{{-1, 0}, {2, 0}, {0, 2}, {5, 5}} {
+		if tile := gameMap.TileAt("ground", cell.X, cell.Y); tile != nil {
+			t.Errorf("cell %v out of range has gid %d", cell, tile.GlobalTileID)
+		}
+	}
+	if tile := gameMap.TileAt("missing", 0, 0); tile != nil {
+		t.Errorf("missing layer has gid %d at 0,0", tile.GlobalTileID)
+	}
+}
+
+func TestTopTileAt(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(3, 1, csvLayer(1, "ground", 3, 1, 1, 2, 0)+csvLayer(2, "top", 3, 1, 5, 0, 0)+
+		` <layer id="3" name="hidden" width="3" height="1" visible="0">
+  <data encoding="csv">9,9,9</data>
+ </layer>
+`))
+
+	tests := []struct {
+		x     int
+		gid   uint32
+		layer string
+	}{
+		{0, 5, "top"},
+		{1, 2, "ground"},
+		{2, 0, ""},
+	}
+	for _, test := range tests {
+		tile, layer := gameMap.TopTileAt(test.x, 0)
+		var gid uint32
+		var name string
+		if tile != nil {
+			gid, name = tile.GlobalTileID, layer.Name
+		}
+		if gid != test.gid || name != test.layer {
+			t.Errorf("TopTileAt(%d, 0) = gid %d on '%s', want gid %d on '%s'", test.x, gid, name, test.gid, test.layer)
+		}
+	}
+}
+
+func TestReloadDecodesChangedLayers(t *testing.T) {
+	ground := csvLayer(1, "ground", 2, 1, 1, 2)
+	dir := writeTestFiles(t, newTestFS(testTMX(2, 1, ground+csvLayer(2, "walls", 2, 1, 3, 0))))
+	path := filepath.Join(dir, "map.tmx")
+	gameMap, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groundTile, wallTile := gameMap.TileAt("ground", 0, 0), gameMap.TileAt("walls", 0, 0)
+
+	if err := os.WriteFile(path, []byte(testTMX(2, 1, ground+csvLayer(2, "walls", 2, 1, 4, 0))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := gameMap.Reload(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if tile := gameMap.TileAt("ground", 0, 0); tile != groundTile {
+		t.Error("unchanged layer was decoded again")
+	} else if tile.Tileset != gameMap.Tilesets[0] || tile.layer != gameMap.GetLayerByName("ground") {
+		t.Error("kept tiles reference the previous tileset or layer")
+	}
+	if tile := gameMap.TileAt("walls", 0, 0); tile == wallTile || tile.GlobalTileID != 4 {
+		t.Errorf("changed layer wasn't decoded again, tile %+v", tile)
+	}
+}
+
+func TestReloadDiscardsEdits(t *testing.T) {
+	dir := writeTestFiles(t, newTestFS(testTMX(2, 1, csvLayer(1, "ground", 2, 1, 1, 2))))
+	path := filepath.Join(dir, "map.tmx")
+	gameMap, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ground := gameMap.Layers[0]
+	if err := ground.SetTile(gameMap, 0, 0, 5); err != nil {
+		t.Fatal(err)
+	}
+	gameMap.TileAt("ground", 1, 0).SetFlip(true, false, false)
+
+	// the file didn't change, but the edited tiles must not be kept
+	if err := gameMap.Reload(path); err != nil {
+		t.Fatal(err)
+	}
+	if tile := gameMap.TileAt("ground", 0, 0); tile == nil || tile.GlobalTileID != 1 {
+		t.Errorf("cell 0,0 has tile %+v after reloading, want the file's gid 1", tile)
+	}
+	if tile := gameMap.TileAt("ground", 1, 0); tile == nil || tile.FlippedHorizontally {
+		t.Errorf("cell 1,0 has tile %+v after reloading, want the file's unflipped tile", tile)
+	}
+}
+
+func TestObjectLookup(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(4, 4, ` <objectgroup id="1" name="first">
+  <object id="7" name="door" type="exit" x="0" y="0"/>
+  <object id="3" name="chest" type="loot" x="16" y="0"/>
+ </objectgroup>
+ <objectgroup id="2" name="second">
+  <object id="5" name="door" type="exit" x="32" y="0"/>
+  <object id="9" name="coin" type="loot" x="48" y="0"/>
+  <object id="4" name="key" type="loot" x="0" y="16"/>
+ </objectgroup>
+`))
+
+	// duplicate names resolve to the first object in document order
+	if door := gameMap.GetObjectByName("door"); door == nil || door.ID != 7 {
+		t.Errorf("GetObjectByName(door) = %v, want object 7", door)
+	}
+	if object := gameMap.GetObjectByName("missing"); object != nil {
+		t.Errorf("GetObjectByName(missing) = object %d", object.ID)
+	}
+
+	if coin := gameMap.GetObjectByID(9); coin == nil || coin.Name != "coin" {
+		t.Errorf("GetObjectByID(9) = %v, want the coin", coin)
+	}
+	if object := gameMap.GetObjectByID(1); object != nil {
+		t.Errorf("GetObjectByID(1) = %s", object.Name)
+	}
+
+	var ids []int
+	for _, object := range gameMap.GetObjectsByType("loot") {
+		ids = append(ids, object.ID)
+	}
+	if fmt.Sprint(ids) != "[3 9 4]" {
+		t.Errorf("loot objects have ids %v, want [3 9 4]", ids)
+	}
+	if objects := gameMap.GetObjectsByType("enemy"); len(objects) != 0 {
+		t.Errorf("found %d objects of an absent type", len(objects))
+	}
+}
+
+func TestEachObject(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(2, 2, ` <objectgroup id="1" name="spawns">
+  <object id="1" name="player" x="0" y="0"/>
+  <object id="2" name="enemy" x="16" y="0"/>
+ </objectgroup>
+ <objectgroup id="2" name="empty"/>
+ <objectgroup id="3" name="items">
+  <object id="3" name="coin" x="0" y="16"/>
+ </objectgroup>
+`))
+
+	var seen []string
+	gameMap.EachObject(func(group *ObjectGroup, obj *Object) {
+		seen = append(seen, group.Name+"/"+obj.Name)
+	})
+	if want := []string{"spawns/player", "spawns/enemy", "items/coin"}; strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("EachObject visited %v, want %v", seen, want)
+	}
+}
+
+func TestTileFromByteArray(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		h, v, d bool
+	}{
+		{[]byte{7, 0, 0, 0x00}, false, false, false},
+		{[]byte{7, 0, 0, 0x80}, true, false, false},
+		{[]byte{7, 0, 0, 0x40}, false, true, false},
+		{[]byte{7, 0, 0, 0x20}, false, false, true},
+		{[]byte{7, 0, 0, 0xc0}, true, true, false},
+		{[]byte{7, 0, 0, 0xa0}, true, false, true},
+		{[]byte{7, 0, 0, 0x60}, false, true, true},
+		{[]byte{7, 0, 0, 0xe0}, true, true, true},
+	}
+	for _, test := range tests {
+		tile := TileFromByteArray(test.data)
+		if tile.GlobalTileID != 7 || tile.FlippedHorizontally != test.h || tile.FlippedVertically != test.v || tile.FlippedDiagonally != test.d {
+			t.Errorf("bytes %x decoded to gid %d with flips h=%v v=%v d=%v", test.data, tile.GlobalTileID,
+				tile.FlippedHorizontally, tile.FlippedVertically, tile.FlippedDiagonally)
+		}
+	}
+}
+
+func TestNonSquareTileSlicing(t *testing.T) {
+	fsys := newTestFS(testTMX(1, 1, csvLayer(1, "ground", 1, 1, 6)))
+	fsys["tiles.tsx"].Data = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.8" tiledversion="1.8.2" name="tiles" tilewidth="16" tileheight="24" tilecount="8" columns="4">
+ <image source="tiles.png" width="64" height="48"/>
+</tileset>
+`)
+	fsys["tiles.png"].Data = tilesetPNG(4, 2, 16, 24)
+	tileset := loadTestMapFS(t, fsys).Tilesets[0]
+
+	if bounds := tileset.Tiles[5].Bounds(); bounds != image.Rect(16, 24, 32, 48) {
+		t.Errorf("tile 5 has bounds %v, want (16,24)-(32,48)", bounds)
+	}
+	if bounds := tileset.Tiles[7].Bounds(); bounds != image.Rect(48, 24, 64, 48) {
+		t.Errorf("tile 7 has bounds %v, want (48,24)-(64,48)", bounds)
+	}
+}
+
+func TestTilesetColumnsAttribute(t *testing.T) {
+	var tileset Tileset
+	data := `<tileset firstgid="1" name="tiles" tilewidth="16" tileheight="16" tilecount="12" columns="3"/>`
+	if err := xml.Unmarshal([]byte(data), &tileset); err != nil {
+		t.Fatal(err)
+	}
+	if tileset.Columns != 3 {
+		t.Errorf("tileset has %d columns, want 3", tileset.Columns)
+	}
+}
+
+func TestInvalidTsx(t *testing.T) {
+	tests := []struct {
+		name, tsx, want string
+	}{
+		{"malformed", `<tileset name="tiles" tilewidth="16"`, "tiles.tsx"},
+		{"missing columns", strings.Replace(testTSX(""), ` columns="4"`, "", 1), "no columns"},
+	}
+	for _, test := range tests {
+		fsys := newTestFS(testTMX(1, 1, csvLayer(1, "ground", 1, 1, 1)))
+		fsys["tiles.tsx"].Data = []byte(test.tsx)
+		_, err := LoadFromFS(fsys, "map.tmx")
+		if err == nil {
+			t.Errorf("%s: loading the map didn't fail", test.name)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: error %q doesn't mention %s", test.name, err, test.want)
+		}
+	}
+}
+
+func TestTilePositionNonSquareMap(t *testing.T) {
+	gids := make([]uint32, 40)
+	gids[25] = 1
+	layer := loadTestMap(t, testTMX(10, 4, csvLayer(1, "ground", 10, 4, gids...))).Layers[0]
+	if len(layer.Tiles) != 1 || layer.Tiles[0].X != 5 || layer.Tiles[0].Y != 2 {
+		t.Errorf("tile at index 25 decoded to %v, want 5,2", tilePositions(layer.Tiles))
+	}
+}
+
+func TestLoadTileOnlyMap(t *testing.T) {
+	dir := writeTestFiles(t, newTestFS(testTMX(2, 1, csvLayer(1, "ground", 2, 1, 1, 2))))
+	gameMap, err := LoadFromFile(filepath.Join(dir, "map.tmx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gameMap.ObjectGroups) != 0 || len(gameMap.Layers) != 1 {
+		t.Errorf("map has %d object groups and %d layers, want 0 and 1", len(gameMap.ObjectGroups), len(gameMap.Layers))
+	}
+}
+
+func TestInlineTileset(t *testing.T) {
+	tmx := strings.Replace(testTMX(2, 1, csvLayer(1, "ground", 2, 1, 6, 16)), ` <tileset firstgid="1" source="tiles.tsx"/>`,
+		` <tileset firstgid="1" name="tiles" tilewidth="16" tileheight="16" tilecount="16" columns="4">
+  <image source="tiles.png" width="64" height="64"/>
+ </tileset>`, 1)
+	fsys := newTestFS(tmx)
+	delete(fsys, "tiles.tsx")
+	gameMap := loadTestMapFS(t, fsys)
+
+	tileset := gameMap.Tilesets[0]
+	if tileset.Columns != 4 || tileset.TileCount != 16 || len(tileset.Tiles) != 16 {
+		t.Fatalf("inline tileset has %d columns, %d tiles and %d tile images", tileset.Columns, tileset.TileCount, len(tileset.Tiles))
+	}
+	rendered := gameMap.Layers[0].render(gameMap, false)
+	for i, id := range []int{5, 15} {
+		if got := pixelAt(rendered, i*16+8, 8); got != tileColor(id) {
+			t.Errorf("cell %d has color %v, want tile %d %v", i, got, id, tileColor(id))
+		}
+	}
+}
+
+func TestTilesetMarginSpacing(t *testing.T) {
+	// 2x2 tiles with a margin of 2 and a spacing of 1, the padding is magenta
+	const margin, spacing = 2, 1
+	magenta := color.RGBA{R: 0xff, B: 0xff, A: 0xff}
+	img := image.NewRGBA(image.Rect(0, 0, 2*margin+2*16+spacing, 2*margin+2*16+spacing))
+	draw.Draw(img, img.Bounds(), image.NewUniform(magenta), image.Point{}, draw.Src)
+	for id := 0; id < 4; id++ {
+		x0, y0 := margin+(id%2)*(16+spacing), margin+(id/2)*(16+spacing)
+		draw.Draw(img, image.Rect(x0, y0, x0+16, y0+16), image.NewUniform(tileColor(id)), image.Point{}, draw.Src)
+	}
+
+	fsys := newTestFS(testTMX(4, 1, csvLayer(1, "ground", 4, 1, 1, 2, 3, 4)))
+	fsys["tiles.tsx"].Data = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.8" tiledversion="1.8.2" name="tiles" tilewidth="16" tileheight="16" spacing="1" margin="2" tilecount="4" columns="2">
+ <image source="tiles.png" width="37" height="37"/>
+</tileset>
+`)
+	fsys["tiles.png"].Data = encodePNG(img)
+	gameMap := loadTestMapFS(t, fsys)
+	tileset := gameMap.Tilesets[0]
+
+	for id, want := range []image.Rectangle{
+		image.Rect(2, 2, 18, 18),
+		image.Rect(19, 2, 35, 18),
+		image.Rect(2, 19, 18, 35),
+		image.Rect(19, 19, 35, 35),
+	} {
+		if got := tileset.Tiles[id].Bounds(); got != want {
+			t.Errorf("tile %d has bounds %v, want %v", id, got, want)
+		}
+	}
+
+	rendered := gameMap.Layers[0].render(gameMap, false)
+	for id := 0; id < 4; id++ {
+		for _, p := range []image.Point{{0, 0}, {15, 0}, {0, 15}, {15, 15}} {
+			if got := pixelAt(rendered, id*16+p.X, p.Y); got != tileColor(id) {
+				t.Errorf("tile %d has color %v at %v, want %v", id, got, p, tileColor(id))
+			}
+		}
+	}
+}
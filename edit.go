@@ -0,0 +1,119 @@
+package ebitmx
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// clearImage is drawn with CompositeModeClear to erase a region of an image
+var clearImage *ebiten.Image
+
+// SetTile sets the cell x, y of the layer to the given gid, which may include flip flags.
+// A gid of 0 clears the cell. Unlike marking the layer dirty, only the area of the changed tile
+// is redrawn in the cached render, so it's cheap to change single tiles every frame.
+// The layer's Data isn't updated, use EncodeData to serialize the changed tiles.
+func (l *Layer) SetTile(gameMap *TmxMap, x, y int, gid uint32) error {
+	if !image.Pt(x, y).In(l.Bounds()) {
+		return fmt.Errorf("cell %d,%d is outside of layer '%s'", x, y, l.Name)
+	}
+	l.ensureDecoded()
+
+	newTile, err := l.newTile(gameMap, gid, x, y)
+	if err != nil {
+		return err
+	}
+
+	// Tiles are kept in row-major order
+	i := sort.Search(len(l.Tiles), func(i int) bool {
+		return l.Tiles[i].Y > y || (l.Tiles[i].Y == y && l.Tiles[i].X >= x)
+	})
+	var oldTile *Tile
+	if i < len(l.Tiles) && l.Tiles[i].X == x && l.Tiles[i].Y == y {
+		oldTile = l.Tiles[i]
+	}
+	switch {
+	case oldTile == nil && newTile == nil:
+		return nil
+	case oldTile == nil:
+		l.Tiles = append(l.Tiles, nil)
+		copy(l.Tiles[i+1:], l.Tiles[i:])
+		l.Tiles[i] = newTile
+	case newTile == nil:
+		l.Tiles = append(l.Tiles[:i], l.Tiles[i+1:]...)
+	default:
+		l.Tiles[i] = newTile
+	}
+	if l.grid != nil {
+		if i, ok := cellIndex(l.Bounds(), x, y); ok {
+			l.grid[i] = newTile
+		}
+	}
+
+	// the tiles no longer match the layer data, so Reload has to decode it again
+	l.dataHash = 0
+
+	if gameMap.chunks != nil {
+		chunkSize := gameMap.ChunkSize()
+		gameMap.chunks.drop(chunkKey{layer: l, x: floorDiv(x, chunkSize.X), y: floorDiv(y, chunkSize.Y)})
+	}
+
+	// a full render is pending anyway
+	if l.Rendered == nil || l.dirty || l.renderedVisible != l.Visible {
+		return nil
+	}
+	// hidden layers render empty
+	if !l.Visible {
+		return nil
+	}
+	var region image.Rectangle
+	if oldTile != nil {
+		region = l.tileRect(gameMap, oldTile)
+	}
+	if newTile != nil {
+		region = region.Union(l.tileRect(gameMap, newTile))
+	}
+	l.redrawRegion(gameMap, region)
+	return nil
+}
+
+// tileRect returns the area of the map in pixels covered by the tile when drawn, see drawTile
+func (l *Layer) tileRect(gameMap *TmxMap, tile *Tile) image.Rectangle {
+	w, h := tile.Tileset.TileImage(int(tile.InternalTileID), gameMap.animationTime).Size()
+	pos := gameMap.TileToPixel(tile.X, tile.Y)
+	min := image.Pt(pos.X+l.Offsetx, pos.Y+gameMap.TileHeight-h+l.Offsety)
+	if tile.FlippedDiagonally {
+		w, h = h, w
+	}
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(w, h))}
+}
+
+// redrawRegion clears region of the cached render and draws the tiles overlapping it again
+func (l *Layer) redrawRegion(gameMap *TmxMap, region image.Rectangle) {
+	region = region.Intersect(l.Rendered.Bounds())
+	if region.Empty() {
+		return
+	}
+
+	if clearImage == nil {
+		clearImage = ebiten.NewImage(1, 1)
+	}
+	op := &ebiten.DrawImageOptions{CompositeMode: ebiten.CompositeModeClear}
+	op.GeoM.Scale(float64(region.Dx()), float64(region.Dy()))
+	op.GeoM.Translate(float64(region.Min.X), float64(region.Min.Y))
+	l.Rendered.DrawImage(clearImage, op)
+
+	// drawing onto the sub image clips the neighbouring tiles to the region
+	dst := l.Rendered.SubImage(region).(*ebiten.Image)
+	op = &ebiten.DrawImageOptions{}
+	for _, tile := range l.tilesInRenderOrder(gameMap.Renderorder) {
+		if !l.tileRect(gameMap, tile).Overlaps(region) {
+			continue
+		}
+		if l.drawTile(dst, gameMap, tile, image.Point{}, op) {
+			l.animated = true
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package ebitmx
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSetTileRedrawsCell(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(3, 3, csvLayer(1, "ground", 3, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1)))
+	layer := gameMap.Layers[0]
+	rendered := layer.render(gameMap, false)
+	before := make(map[image.Point]color.RGBA)
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 48; x++ {
+			before[image.Pt(x, y)] = pixelAt(rendered, x, y)
+		}
+	}
+
+	if err := layer.SetTile(gameMap, 1, 1, 6); err != nil {
+		t.Fatal(err)
+	}
+	if layer.render(gameMap, false) != rendered {
+		t.Fatal("SetTile dropped the cached render")
+	}
+
+	cell := image.Rect(16, 16, 32, 32)
+	for p, old := range before {
+		got := pixelAt(rendered, p.X, p.Y)
+		switch {
+		case !p.In(cell):
+			if got != old {
+				t.Errorf("pixel %v outside of the edited cell changed from %v to %v", p, old, got)
+			}
+		case p == cell.Min:
+			if got != white {
+				t.Errorf("marker of the new tile has color %v", got)
+			}
+		case got != tileColor(5):
+			t.Errorf("pixel %v of the edited cell has color %v, want %v", p, got, tileColor(5))
+		}
+	}
+}
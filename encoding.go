@@ -0,0 +1,302 @@
+package ebitmx
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultMaxDecompressedSize is the decompressed size limit used unless WithMaxDecompressedSize is given
+const defaultMaxDecompressedSize = 256 << 20
+
+// ErrDecompressedSizeExceeded is returned when compressed data inflates beyond the limit set by WithMaxDecompressedSize
+var ErrDecompressedSizeExceeded = errors.New("decompressed data exceeds the size limit")
+
+// decodeBase64 decodes base64 encoded data and decompresses it if needed, reading at most limit bytes
+func decodeBase64(text string, compression Compression, limit int64) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, err
+	}
+	return decompress(data, compression, limit)
+}
+
+func decompress(data []byte, compression Compression, limit int64) ([]byte, error) {
+	if compression == "" {
+		return data, nil
+	}
+	r, err := decompressReader(bytes.NewReader(data), compression)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	decompressed, err := io.ReadAll(limitDecompressed(r, limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed decompressing %s data: %w", compression, err)
+	}
+	return decompressed, nil
+}
+
+// limitDecompressed wraps r so reading more than limit bytes fails with ErrDecompressedSizeExceeded.
+// A limit <= 0 disables the check.
+func limitDecompressed(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+	return &sizeLimitedReader{r: io.LimitReader(r, limit+1), left: limit}
+}
+
+type sizeLimitedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (s *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.left -= int64(n)
+	if s.left < 0 {
+		return n, ErrDecompressedSizeExceeded
+	}
+	return n, err
+}
+
+func decompressReader(r io.Reader, compression Compression) (io.ReadCloser, error) {
+	switch compression {
+	case "":
+		return io.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zlib:
+		return zlib.NewReader(r)
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported compression '%s'", compression)
+}
+
+// StreamTiles decodes the layer data cell by cell and calls fn with each cell's encoded gid,
+// including flip flags. Empty cells are passed gid 0. Cells are visited in row-major order, for
+// infinite maps chunk by chunk in document order with x, y being absolute cell coordinates.
+// Unlike DecodeData the tiles are never stored, so memory use stays constant for huge layers.
+// Iteration stops at the first error returned by fn.
+func (l *Layer) StreamTiles(gameMap *TmxMap, fn func(x, y int, gid uint32) error) error {
+	if len(l.Data.Chunks) == 0 {
+		width := l.Width
+		if width == 0 {
+			width = gameMap.Width
+		}
+		return l.streamBlock(gameMap, l.Data.Text, 0, 0, width, fn)
+	}
+	for _, chunk := range l.Data.Chunks {
+		if err := l.streamBlock(gameMap, chunk.Text, chunk.X, chunk.Y, chunk.Width, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamBlock streams a block of encoded layer data with the given width whose top left cell is at x0, y0
+func (l *Layer) streamBlock(gameMap *TmxMap, text string, x0, y0, width int, fn func(x, y int, gid uint32) error) error {
+	if width <= 0 {
+		return fmt.Errorf("layer '%s' has invalid width %d", l.Name, width)
+	}
+	cell := 0
+	yield := func(gid uint32) error {
+		err := fn(x0+cell%width, y0+cell/width, gid)
+		cell++
+		return err
+	}
+
+	switch l.Data.Encoding {
+	case Base64:
+		b64 := base64.NewDecoder(base64.StdEncoding, strings.NewReader(strings.TrimSpace(text)))
+		r, err := decompressReader(b64, l.Data.Compression)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		br := bufio.NewReader(limitDecompressed(r, gameMap.options.maxDecompressedSize))
+		var buf [4]byte
+		for {
+			if _, err := io.ReadFull(br, buf[:]); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := yield(binary.LittleEndian.Uint32(buf[:])); err != nil {
+				return err
+			}
+		}
+
+	case CSV:
+		return eachCSVGID(text, yield)
+	}
+	return fmt.Errorf("unsupported encoding '%s'", l.Data.Encoding)
+}
+
+// decodeCSV parses the comma separated gids of CSV layer data
+func decodeCSV(text string) ([]uint32, error) {
+	var gids []uint32
+	err := eachCSVGID(text, func(gid uint32) error {
+		gids = append(gids, gid)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gids, nil
+}
+
+// eachCSVGID calls fn with each gid of CSV layer data, stopping at the first error
+func eachCSVGID(text string, fn func(gid uint32) error) error {
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Split(scanCSV)
+	for cell := 0; scanner.Scan(); cell++ {
+		gid, err := strconv.ParseUint(scanner.Text(), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid gid '%s' in csv data at cell %d", scanner.Text(), cell)
+		}
+		if err := fn(uint32(gid)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// scanCSV is a bufio.SplitFunc returning the comma separated values with whitespace trimmed
+func scanCSV(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for start < len(data) && (data[start] == ',' || isSpace(data[start])) {
+		start++
+	}
+	for i := start; i < len(data); i++ {
+		if data[i] == ',' || isSpace(data[i]) {
+			return i + 1, data[start:i], nil
+		}
+	}
+	if atEOF && start < len(data) {
+		return len(data), data[start:], nil
+	}
+	return start, nil, nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t'
+}
+
+// EncodeData encodes the layer's tiles, including their flip flags, in the given encoding.
+// CSV output is formatted like Tiled writes it: one line per row, each row but the last
+// ending with a comma. Compression is only supported for Base64.
+func (l *Layer) EncodeData(encoding DataEncoding, compression Compression) (string, error) {
+	return l.encodeData(encoding, compression, -1)
+}
+
+// encodeData is EncodeData with the given compression level, see compressLevel
+func (l *Layer) encodeData(encoding DataEncoding, compression Compression, level int) (string, error) {
+	gids := l.RawGIDs()
+
+	switch encoding {
+	case CSV:
+		if compression != "" {
+			return "", errors.New("csv layer data can't be compressed")
+		}
+		width, height := l.Bounds().Dx(), l.Bounds().Dy()
+		var b strings.Builder
+		b.WriteString("\n")
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				b.WriteString(strconv.FormatUint(uint64(gids[y*width+x]), 10))
+				if x < width-1 || y < height-1 {
+					b.WriteString(",")
+				}
+			}
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+
+	case Base64:
+		data := make([]byte, 4*len(gids))
+		for i, gid := range gids {
+			binary.LittleEndian.PutUint32(data[4*i:], gid)
+		}
+		data, err := compressLevel(data, compression, level)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+	return "", fmt.Errorf("unsupported encoding '%s'", encoding)
+}
+
+// RawGIDs returns the encoded gids of all cells within the layer's Bounds in row-major order,
+// with flip flags and 0 for empty cells, as they are stored in the layer data
+func (l *Layer) RawGIDs() []uint32 {
+	l.ensureDecoded()
+	bounds := l.Bounds()
+	gids := make([]uint32, bounds.Dx()*bounds.Dy())
+	for _, tile := range l.Tiles {
+		if i, ok := cellIndex(bounds, tile.X, tile.Y); ok {
+			gids[i] = tile.GID()
+		}
+	}
+	return gids
+}
+
+// compressLevel compresses data with the given level, -1 being the default level of the compression.
+// Gzip takes levels 0 to 9 and -2 for Huffman-only compression, zlib 0 to 9 and zstd 1 to 22.
+func compressLevel(data []byte, compression Compression, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch compression {
+	case "":
+		return data, nil
+	case Gzip:
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return nil, fmt.Errorf("invalid gzip compression level %d", level)
+		}
+		w, err = gzip.NewWriterLevel(&buf, level)
+	case Zlib:
+		if level < zlib.DefaultCompression || level > zlib.BestCompression {
+			return nil, fmt.Errorf("invalid zlib compression level %d", level)
+		}
+		w, err = zlib.NewWriterLevel(&buf, level)
+	case Zstd:
+		if level != -1 && (level < 1 || level > 22) {
+			return nil, fmt.Errorf("invalid zstd compression level %d", level)
+		}
+		var opts []zstd.EOption
+		if level != -1 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		w, err = zstd.NewWriter(&buf, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported compression '%s'", compression)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,204 @@
+package ebitmx
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestStreamTiles(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(3, 2, csvLayer(1, "ground", 3, 2, 1, 0, 3, 4, 5|FLIPPED_VERTICALLY_FLAG, 6)))
+	layer := gameMap.Layers[0]
+	want := map[image.Point]uint32{
+		{0, 0}: 1, {1, 0}: 0, {2, 0}: 3,
+		{0, 1}: 4, {1, 1}: 5 | FLIPPED_VERTICALLY_FLAG, {2, 1}: 6,
+	}
+
+	encoded, err := layer.EncodeData(Base64, Zlib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := &Layer{Width: 3, Height: 2, Data: LayerData{Text: encoded, Encoding: Base64, Compression: Zlib}}
+	checkStreamedCells(t, "csv", gameMap, layer, want)
+	checkStreamedCells(t, "base64 zlib", gameMap, compressed, want)
+
+	chunked := loadTestMap(t, chunkedTMX)
+	checkStreamedCells(t, "chunked", chunked, chunked.Layers[0], map[image.Point]uint32{
+		{2, 0}: 5, {3, 0}: 6, {2, 1}: 7, {3, 1}: 8,
+		{-2, -1}: 1, {-1, -1}: 2, {-2, 0}: 3, {-1, 0}: 0,
+	})
+}
+
+func TestStreamTilesInvalidWidth(t *testing.T) {
+	gameMap := NewMap(0, 0, testTileSize, testTileSize)
+	layers := map[string]*Layer{
+		"no width": {Name: "ground", Data: LayerData{Encoding: CSV, Text: "1,2"}},
+		"zero-width chunk": {Name: "ground", Width: 4, Data: LayerData{Encoding: CSV, Chunks: []Chunk{
+			{X: 0, Y: 0, Width: 0, Height: 2, Text: "1,2"},
+		}}},
+	}
+	for name, layer := range layers {
+		err := layer.StreamTiles(gameMap, func(x, y int, gid uint32) error {
+			t.Errorf("%s: cell %d,%d streamed", name, x, y)
+			return nil
+		})
+		if err == nil || !strings.Contains(err.Error(), "invalid width 0") {
+			t.Errorf("%s: streaming gave %v, want an invalid width error", name, err)
+		}
+	}
+}
+
+// checkStreamedCells checks that StreamTiles visits every cell of want exactly once with its gid
+func checkStreamedCells(t *testing.T, name string, gameMap *TmxMap, layer *Layer, want map[image.Point]uint32) {
+	t.Helper()
+	visited := make(map[image.Point]int)
+	err := layer.StreamTiles(gameMap, func(x, y int, gid uint32) error {
+		cell := image.Pt(x, y)
+		visited[cell]++
+		if gid != want[cell] {
+			t.Errorf("%s: cell %v has gid %d, want %d", name, cell, gid, want[cell])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	for cell := range want {
+		if visited[cell] != 1 {
+			t.Errorf("%s: cell %v visited %d times", name, cell, visited[cell])
+		}
+	}
+	if len(visited) != len(want) {
+		t.Errorf("%s: visited %d cells, want %d", name, len(visited), len(want))
+	}
+}
+
+func TestLayerRawGIDs(t *testing.T) {
+	gids := []uint32{
+		0, 1 | FLIPPED_HORIZONTALLY_FLAG, 0,
+		16 | FLIPPED_VERTICALLY_FLAG | FLIPPED_DIAGONALLY_FLAG, 0, 2,
+	}
+	stream := make([]byte, 4*len(gids))
+	for i, gid := range gids {
+		binary.LittleEndian.PutUint32(stream[4*i:], gid)
+	}
+	gameMap := loadTestMap(t, testTMX(3, 2, fmt.Sprintf(` <layer id="1" name="ground" width="3" height="2">
+  <data encoding="base64">%s</data>
+ </layer>
+`, base64.StdEncoding.EncodeToString(stream))))
+
+	raw := gameMap.Layers[0].RawGIDs()
+	if len(raw) != len(gids) {
+		t.Fatalf("got %d gids, want %d", len(raw), len(gids))
+	}
+	for i, gid := range raw {
+		if want := binary.LittleEndian.Uint32(stream[4*i:]); gid != want {
+			t.Errorf("cell %d has raw gid %#x, want %#x", i, gid, want)
+		}
+	}
+}
+
+func TestMaxDecompressedSize(t *testing.T) {
+	// 64 cells inflate to 256 bytes
+	data, err := compressLevel(make([]byte, 4*64), Gzip, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := newTestFS(testTMX(8, 8, fmt.Sprintf(` <layer id="1" name="ground" width="8" height="8">
+  <data encoding="base64" compression="gzip">%s</data>
+ </layer>
+`, base64.StdEncoding.EncodeToString(data))))
+
+	_, err = LoadFromFS(fsys, "map.tmx", WithMaxDecompressedSize(100))
+	if !errors.Is(err, ErrDecompressedSizeExceeded) {
+		t.Errorf("loading an over-limit payload gave %v, want ErrDecompressedSizeExceeded", err)
+	}
+	loadTestMapFS(t, fsys, WithMaxDecompressedSize(256))
+}
+
+func TestDecodeCSV(t *testing.T) {
+	gids, err := decodeCSV("\n 1, 2,\r\n0,\t2147483652\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint32{1, 2, 0, 4 | FLIPPED_HORIZONTALLY_FLAG}; !equalGIDs(gids, want) {
+		t.Errorf("decoded gids %v, want %v", gids, want)
+	}
+
+	for _, text := range []string{"1,x,3", "1,-2,3", "1,4294967296,3"} {
+		_, err := decodeCSV(text)
+		if err == nil || !strings.Contains(err.Error(), "at cell 1") {
+			t.Errorf("decoding %q gave error %v, want an error naming cell 1", text, err)
+		}
+	}
+
+	gameMap := loadTestMap(t, testTMX(2, 2, csvLayer(1, "ground", 2, 2, 1, 0, 0, 6|FLIPPED_VERTICALLY_FLAG)))
+	layer := gameMap.Layers[0]
+	if len(layer.Tiles) != 2 {
+		t.Fatalf("decoded %d tiles, want 2", len(layer.Tiles))
+	}
+	if tile := layer.Tiles[1]; tile.X != 1 || tile.Y != 1 || tile.InternalTileID != 5 || !tile.FlippedVertically || tile.Tileset == nil {
+		t.Errorf("decoded tile %+v, want internal id 5 at 1,1 flipped vertically", tile)
+	}
+
+	unknown := &Layer{Width: 1, Height: 1, Data: LayerData{Text: "1", Encoding: "xml"}}
+	if err := unknown.DecodeData(gameMap); err == nil {
+		t.Error("decoding an unknown encoding didn't fail")
+	}
+}
+
+func equalGIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCompressedLayerData(t *testing.T) {
+	gids := []uint32{1, 0, 3, 4 | FLIPPED_DIAGONALLY_FLAG}
+	source := testLayer(t, 2, 2, gids)
+
+	for _, compression := range []Compression{"", Gzip, Zlib, Zstd} {
+		text, err := source.EncodeData(Base64, compression)
+		if err != nil {
+			t.Fatalf("%s: %s", compression, err)
+		}
+		tmx := testTMX(2, 2, fmt.Sprintf(` <layer id="1" name="ground" width="2" height="2">
+  <data encoding="base64" compression="%s">%s</data>
+ </layer>
+`, compression, text))
+		if got := loadTestMap(t, tmx).Layers[0].RawGIDs(); !equalGIDs(got, gids) {
+			t.Errorf("%s: decoded gids %v, want %v", compression, got, gids)
+		}
+
+		if compression == "" {
+			continue
+		}
+		data, _ := base64.StdEncoding.DecodeString(text)
+		truncated := base64.StdEncoding.EncodeToString(data[:len(data)/2])
+		if _, err := LoadFromFS(newTestFS(strings.Replace(tmx, text, truncated, 1)), "map.tmx"); err == nil {
+			t.Errorf("%s: truncated data loaded without error", compression)
+		}
+	}
+}
+
+// testLayer returns a layer with the given gids on a width x height map using the test tileset
+func testLayer(t *testing.T, width, height int, gids []uint32) *Layer {
+	t.Helper()
+	gameMap := NewMap(width, height, testTileSize, testTileSize)
+	gameMap.AddTileset(testTileset())
+	layer, err := gameMap.AddTileLayer("ground", gids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
@@ -0,0 +1,309 @@
+package ebitmx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LayerEntry is an element of the map's layer stack, exactly one of the fields is set
+type LayerEntry struct {
+	Layer       *Layer
+	ObjectGroup *ObjectGroup
+	ImageLayer  *ImageLayer
+}
+
+// Name returns the name of the entry's layer
+func (e *LayerEntry) Name() string {
+	switch {
+	case e.Layer != nil:
+		return e.Layer.Name
+	case e.ObjectGroup != nil:
+		return e.ObjectGroup.Name
+	case e.ImageLayer != nil:
+		return e.ImageLayer.Name
+	}
+	return ""
+}
+
+// IsVisible reports whether the entry's layer is visible
+func (e *LayerEntry) IsVisible() bool {
+	switch {
+	case e.Layer != nil:
+		return bool(e.Layer.Visible)
+	case e.ObjectGroup != nil:
+		return bool(e.ObjectGroup.Visible)
+	case e.ImageLayer != nil:
+		return bool(e.ImageLayer.Visible)
+	}
+	return false
+}
+
+func (e *LayerEntry) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	switch start.Name.Local {
+	case "layer":
+		e.Layer = &Layer{}
+		return d.DecodeElement(e.Layer, &start)
+	case "objectgroup":
+		e.ObjectGroup = &ObjectGroup{}
+		return d.DecodeElement(e.ObjectGroup, &start)
+	case "imagelayer":
+		e.ImageLayer = &ImageLayer{}
+		return d.DecodeElement(e.ImageLayer, &start)
+	}
+	return d.Skip()
+}
+
+func (e *LayerEntry) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	switch {
+	case e.Layer != nil:
+		return enc.EncodeElement(e.Layer, xml.StartElement{Name: xml.Name{Local: "layer"}})
+	case e.ObjectGroup != nil:
+		return enc.EncodeElement(e.ObjectGroup, xml.StartElement{Name: xml.Name{Local: "objectgroup"}})
+	case e.ImageLayer != nil:
+		return enc.EncodeElement(e.ImageLayer, xml.StartElement{Name: xml.Name{Local: "imagelayer"}})
+	}
+	return nil
+}
+
+func (t *TmxMap) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type tmxMap TmxMap
+	// an absent compression level means the library default, not 0 which is no compression
+	t.Compressionlevel = -1
+	if err := d.DecodeElement((*tmxMap)(t), &start); err != nil {
+		return err
+	}
+
+	// drop entries of elements we don't support
+	stack := t.LayerStack[:0]
+	for _, entry := range t.LayerStack {
+		switch {
+		case entry.Layer != nil:
+			t.Layers = append(t.Layers, entry.Layer)
+		case entry.ObjectGroup != nil:
+			t.ObjectGroups = append(t.ObjectGroups, entry.ObjectGroup)
+		case entry.ImageLayer != nil:
+			t.ImageLayers = append(t.ImageLayers, entry.ImageLayer)
+		default:
+			continue
+		}
+		stack = append(stack, entry)
+	}
+	t.LayerStack = stack
+	return nil
+}
+
+func (t *TmxMap) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	type tmxMap TmxMap
+	// Tiled omits the compression level when it's the default
+	out := struct {
+		*tmxMap
+		Compressionlevel *int `xml:"compressionlevel,attr,omitempty"`
+	}{tmxMap: (*tmxMap)(t)}
+	if t.Compressionlevel != -1 {
+		out.Compressionlevel = &t.Compressionlevel
+	}
+	start.Name = xml.Name{Local: "map"}
+	return enc.EncodeElement(out, start)
+}
+
+func (l *Layer) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	type layer Layer
+	// Tiled omits the opacity when it is 1, while an opacity of 0 has to be kept
+	out := struct {
+		*layer
+		Opacity *float64 `xml:"opacity,attr,omitempty"`
+	}{layer: (*layer)(l)}
+	if l.Opacity != 1 {
+		out.Opacity = &l.Opacity
+	}
+	return enc.EncodeElement(out, start)
+}
+
+func (l *ImageLayer) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	type imageLayer ImageLayer
+	// Tiled omits the opacity when it is 1
+	out := struct {
+		*imageLayer
+		Opacity *float64 `xml:"opacity,attr,omitempty"`
+	}{imageLayer: (*imageLayer)(l)}
+	if l.Opacity != 1 {
+		out.Opacity = &l.Opacity
+	}
+	return enc.EncodeElement(out, start)
+}
+
+func (o *ObjectGroup) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	type objectGroup ObjectGroup
+	// Tiled omits the opacity and parallax factors when they are 1
+	out := struct {
+		*objectGroup
+		Opacity   *float64 `xml:"opacity,attr,omitempty"`
+		ParallaxX *float64 `xml:"parallaxx,attr,omitempty"`
+		ParallaxY *float64 `xml:"parallaxy,attr,omitempty"`
+	}{objectGroup: (*objectGroup)(o)}
+	if o.Opacity != 1 {
+		out.Opacity = &o.Opacity
+	}
+	if o.ParallaxX != 1 {
+		out.ParallaxX = &o.ParallaxX
+	}
+	if o.ParallaxY != 1 {
+		out.ParallaxY = &o.ParallaxY
+	}
+	return enc.EncodeElement(out, start)
+}
+
+// MarshalXML writes the data with its text as it is. encoding/xml would escape the newlines
+// of chardata fields, while Tiled writes them as they are.
+func (d LayerData) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if d.Encoding != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "encoding"}, Value: string(d.Encoding)})
+	}
+	if d.Compression != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "compression"}, Value: string(d.Compression)})
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	// the text between the chunks is only indentation, which the encoder writes itself
+	if len(d.Chunks) == 0 || strings.TrimSpace(d.Text) != "" {
+		if err := enc.EncodeToken(xml.CharData(d.Text)); err != nil {
+			return err
+		}
+	}
+	for _, chunk := range d.Chunks {
+		if err := enc.EncodeElement(chunk, xml.StartElement{Name: xml.Name{Local: "chunk"}}); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+func (c Chunk) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr,
+		xml.Attr{Name: xml.Name{Local: "x"}, Value: strconv.Itoa(c.X)},
+		xml.Attr{Name: xml.Name{Local: "y"}, Value: strconv.Itoa(c.Y)},
+		xml.Attr{Name: xml.Name{Local: "width"}, Value: strconv.Itoa(c.Width)},
+		xml.Attr{Name: xml.Name{Local: "height"}, Value: strconv.Itoa(c.Height)},
+	)
+	return encodeText(enc, start, c.Text)
+}
+
+func (d ImageData) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "encoding"}, Value: string(d.Encoding)})
+	if d.Compression != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "compression"}, Value: string(d.Compression)})
+	}
+	return encodeText(enc, start, d.Text)
+}
+
+// encodeText writes an element holding text, keeping its newlines unlike chardata fields
+func encodeText(enc *xml.Encoder, start xml.StartElement, text string) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+		return err
+	}
+	return enc.EncodeToken(start.End())
+}
+
+func (t *Tileset) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if t.Source != "" {
+		// everything else lives in the external tileset file
+		return enc.EncodeElement(struct {
+			FirstGid uint32 `xml:"firstgid,attr"`
+			Source   string `xml:"source,attr"`
+		}{t.FirstGid, t.Source}, start)
+	}
+	type tileset Tileset
+	return enc.EncodeElement((*tileset)(t), start)
+}
+
+func (p Properties) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	// Tiled writes properties sorted by name
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	props := make([]Property, 0, len(p))
+	for _, name := range names {
+		prop := p[name]
+		if prop.Value != "" {
+			// multi-line values were copied into Value when unmarshaling
+			prop.Text = ""
+		}
+		props = append(props, prop)
+	}
+	return enc.EncodeElement(struct {
+		Properties []Property `xml:"property"`
+	}{props}, start)
+}
+
+// WriteTMX writes the map as .tmx XML.
+// Layer data is written as it was loaded, the ids and order of layers and objects are kept and
+// attributes at their defaults are left out like Tiled does, so an unmodified map reads back the same.
+// Elements without content are written with an end tag, unlike Tiled.
+func (t *TmxMap) WriteTMX(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	if err := enc.Encode(t); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteTo writes the map as .tmx XML like WriteTMX, but encodes the layer data from the current
+// tiles, so tiles changed after loading, e.g. with SetTile, are written too. Layer data is written
+// as Base64 using the compression it was loaded with and the map's compression level.
+// The data of infinite maps is written as it was loaded.
+func (t *TmxMap) WriteTo(w io.Writer) (int64, error) {
+	out := *t
+	out.LayerStack = make([]*LayerEntry, len(t.LayerStack))
+	for i, entry := range t.LayerStack {
+		out.LayerStack[i] = entry
+		if entry.Layer == nil || len(entry.Layer.Data.Chunks) > 0 {
+			continue
+		}
+
+		text, err := entry.Layer.encodeData(Base64, entry.Layer.Data.Compression, t.Compressionlevel)
+		if err != nil {
+			return 0, fmt.Errorf("layer '%s': %w", entry.Layer.Name, err)
+		}
+		layer := *entry.Layer
+		layer.Data.Encoding = Base64
+		layer.Data.Text = text
+		out.LayerStack[i] = &LayerEntry{Layer: &layer}
+	}
+
+	cw := &countingWriter{w: w}
+	err := out.WriteTMX(cw)
+	return cw.n, err
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,195 @@
+package ebitmx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// roundTripTMX is written like Tiled writes maps, with layers, groups and objects out of id order
+const roundTripTMX = `<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.8" tiledversion="1.8.2" orientation="orthogonal" renderorder="right-down" width="3" height="2" tilewidth="16" tileheight="16" infinite="0" nextlayerid="5" nextobjectid="4">
+ <tileset firstgid="1" source="tiles.tsx"/>
+ <layer id="3" name="ground" width="3" height="2">
+  <data encoding="csv">
+1,2,3,
+0,0,4
+</data>
+ </layer>
+ <objectgroup id="1" name="objects" opacity="0.5" parallaxx="0.5">
+  <object id="3" name="spawn" x="16" y="16" width="16" height="16"/>
+  <object id="1" name="exit" x="32" y="0" width="16" height="16" visible="0"/>
+ </objectgroup>
+ <layer id="2" name="top" width="3" height="2" visible="0">
+  <data encoding="base64">
+   AQAAAAAAAAAAAAAAAAAAAAAAAAACAAAA
+  </data>
+ </layer>
+</map>
+`
+
+func writeTMX(t *testing.T, gameMap *TmxMap) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gameMap.WriteTMX(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWriteTMXRoundTrip(t *testing.T) {
+	gameMap := loadTestMap(t, roundTripTMX)
+	written := writeTMX(t, gameMap)
+
+	for _, want := range []string{
+		`infinite="0"`,
+		"<data encoding=\"csv\">\n1,2,3,\n0,0,4\n</data>",
+		"<data encoding=\"base64\">\n   AQAAAAAAAAAAAAAAAAAAAAAAAAACAAAA\n  </data>",
+		`<objectgroup id="1" name="objects" opacity="0.5" parallaxx="0.5">`,
+	} {
+		if !strings.Contains(written, want) {
+			t.Errorf("written map lacks %s:\n%s", want, written)
+		}
+	}
+	for _, unwanted := range []string{"&#xA;", "compressionlevel", "parallaxy"} {
+		if strings.Contains(written, unwanted) {
+			t.Errorf("written map contains %s:\n%s", unwanted, written)
+		}
+	}
+
+	reloaded := loadTestMap(t, written)
+	if again := writeTMX(t, reloaded); again != written {
+		t.Errorf("writing the reloaded map changed it:\n%s\nwant:\n%s", again, written)
+	}
+	var order []string
+	for _, entry := range reloaded.LayerStack {
+		order = append(order, entry.Name())
+	}
+	if strings.Join(order, ",") != "ground,objects,top" {
+		t.Errorf("layer order is %v", order)
+	}
+	if reloaded.Layers[0].ID != 3 || reloaded.Layers[1].ID != 2 || reloaded.NextLayerID != 5 || reloaded.NextObjectID != 4 {
+		t.Errorf("layer ids %d, %d and next ids %d, %d changed", reloaded.Layers[0].ID, reloaded.Layers[1].ID, reloaded.NextLayerID, reloaded.NextObjectID)
+	}
+	objects := reloaded.ObjectGroups[0].Objects
+	if objects[0].ID != 3 || objects[1].ID != 1 || objects[1].Visible || reloaded.Layers[1].Visible {
+		t.Errorf("objects have ids %d, %d", objects[0].ID, objects[1].ID)
+	}
+	if got := reloaded.Layers[1].Tiles; len(got) != 2 || got[1].X != 2 || got[1].Y != 1 {
+		t.Errorf("base64 layer decoded to %d tiles", len(got))
+	}
+}
+
+func TestWriteTMXOpacity(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(1, 1, csvLayer(1, "opaque", 1, 1, 1)+
+		strings.Replace(csvLayer(2, "transparent", 1, 1, 1), `height="1"`, `height="1" opacity="0"`, 1)+
+		` <imagelayer id="3" name="sky" opacity="0"/>
+ <objectgroup id="4" name="objects" opacity="0"/>
+ <objectgroup id="5" name="shown"/>
+`))
+	if gameMap.ObjectGroups[1].Opacity != 1 {
+		t.Errorf("object group without opacity has opacity %f, want 1", gameMap.ObjectGroups[1].Opacity)
+	}
+
+	written := writeTMX(t, gameMap)
+	for _, want := range []string{
+		`<layer id="1" name="opaque" width="1" height="1">`,
+		`<layer id="2" name="transparent" width="1" height="1" opacity="0">`,
+		`<imagelayer id="3" name="sky" opacity="0">`,
+		`<objectgroup id="4" name="objects" opacity="0">`,
+		`<objectgroup id="5" name="shown">`,
+	} {
+		if !strings.Contains(written, want) {
+			t.Errorf("written map lacks %s:\n%s", want, written)
+		}
+	}
+
+	reloaded := loadTestMap(t, written)
+	if reloaded.Layers[0].Opacity != 1 || reloaded.Layers[1].Opacity != 0 || reloaded.ImageLayers[0].Opacity != 0 || reloaded.ObjectGroups[0].Opacity != 0 {
+		t.Errorf("reloaded opacities %f, %f, %f, %f, want 1, 0, 0, 0", reloaded.Layers[0].Opacity, reloaded.Layers[1].Opacity,
+			reloaded.ImageLayers[0].Opacity, reloaded.ObjectGroups[0].Opacity)
+	}
+}
+
+func TestWriteToRoundTrip(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(3, 2, csvLayer(1, "plain", 3, 2, 1, 2, 3, 0, 0, 4)+
+		csvLayer(2, "zlib", 3, 2, 0, 5, 0, 6|FLIPPED_VERTICALLY_FLAG, 0, 7)+
+		csvLayer(3, "gzip", 3, 2, 8, 8, 8, 0, 0, 0)+
+		csvLayer(4, "zstd", 3, 2, 0, 0, 0, 9, 10, 11)))
+	gameMap.Compressionlevel = 9
+	gameMap.Layers[1].Data.Compression = Zlib
+	gameMap.Layers[2].Data.Compression = Gzip
+	gameMap.Layers[3].Data.Compression = Zstd
+	if err := gameMap.Layers[0].SetTile(gameMap, 1, 1, 12|FLIPPED_HORIZONTALLY_FLAG); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := gameMap.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := loadTestMap(t, buf.String())
+	if len(reloaded.Layers) != len(gameMap.Layers) {
+		t.Fatalf("reloaded map has %d layers, want %d", len(reloaded.Layers), len(gameMap.Layers))
+	}
+	for i, layer := range gameMap.Layers {
+		again := reloaded.Layers[i]
+		if again.Data.Encoding != Base64 || again.Data.Compression != layer.Data.Compression {
+			t.Errorf("%s: written as %s %s", layer.Name, again.Data.Encoding, again.Data.Compression)
+		}
+		if got, want := again.RawGIDs(), layer.RawGIDs(); !equalGIDs(got, want) {
+			t.Errorf("%s: reloaded gids %v, want %v", layer.Name, got, want)
+		}
+		if got, want := fmt.Sprint(again.TileGrid()), fmt.Sprint(layer.TileGrid()); got != want {
+			t.Errorf("%s: reloaded tile grid %s, want %s", layer.Name, got, want)
+		}
+	}
+}
+
+func TestCompressionLevels(t *testing.T) {
+	data := make([]byte, 64)
+	tests := []struct {
+		compression Compression
+		level       int
+		valid       bool
+	}{
+		{Gzip, -1, true},
+		{Gzip, -2, true},
+		{Gzip, 9, true},
+		{Gzip, -3, false},
+		{Gzip, 10, false},
+		{Zlib, -1, true},
+		{Zlib, 0, true},
+		{Zlib, -2, false},
+		{Zlib, 10, false},
+		{Zstd, -1, true},
+		{Zstd, 1, true},
+		{Zstd, 22, true},
+		{Zstd, 0, false},
+		{Zstd, 23, false},
+	}
+	for _, test := range tests {
+		_, err := compressLevel(data, test.compression, test.level)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s level %d: error %v, want valid %t", test.compression, test.level, err, test.valid)
+		}
+	}
+}
+
+func TestEncodeDataCSV(t *testing.T) {
+	// formatted as Tiled writes it, the last gid has the horizontal flip flag set
+	const data = "\n1,2,3,\n0,0,4,\n5,6,2147483655\n"
+	gameMap := loadTestMap(t, testTMX(3, 3, ` <layer id="1" name="ground" width="3" height="3">
+  <data encoding="csv">`+data+`</data>
+ </layer>
+`))
+
+	encoded, err := gameMap.Layers[0].EncodeData(CSV, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded != data {
+		t.Errorf("encoded csv %q, want %q", encoded, data)
+	}
+}
@@ -0,0 +1,58 @@
+package ebitmx
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// LoadFromReader loads a map from r. Tilesets, templates and images referenced by the map
+// are resolved relative to dir.
+func LoadFromReader(r io.Reader, dir string, opts ...LoadOption) (*TmxMap, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return loadMap(data, dir, newLoadOptions(opts))
+}
+
+// LoadFromFS loads the map at path from fsys, e.g. an embed.FS. Tilesets, templates and images
+// referenced by the map are read from fsys as well, relative to the file referencing them.
+func LoadFromFS(fsys fs.FS, path string, opts ...LoadOption) (*TmxMap, error) {
+	options := newLoadOptions(opts)
+	options.fsys = fsys
+	return loadFromFile(path, options)
+}
+
+// LoadFromFS loads the tileset's TSX file and image from fsys, resolving its source relative to dir
+func (t *Tileset) LoadFromFS(fsys fs.FS, dir string) error {
+	t.fsys = fsys
+	return t.LoadFromTsx(dir)
+}
+
+// readFile reads the named file from fsys, or from the OS if fsys is nil
+func readFile(fsys fs.FS, name string) ([]byte, error) {
+	if fsys == nil {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(fsys, name)
+}
+
+// resolveFile resolves a source found in a file located in dir to a name readFile accepts.
+// Without fsys the result is an absolute path, within fsys it's a slash separated path.
+func resolveFile(fsys fs.FS, dir, source string) (string, error) {
+	if fsys == nil {
+		return filepath.Abs(resolvePath(dir, source))
+	}
+	return path.Join(dir, filepath.ToSlash(source)), nil
+}
+
+// fileDir returns the directory of a file name as returned by resolveFile
+func fileDir(fsys fs.FS, name string) string {
+	if fsys == nil {
+		return filepath.Dir(name)
+	}
+	return path.Dir(name)
+}
@@ -0,0 +1,52 @@
+package ebitmx
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadFromReader(t *testing.T) {
+	// the tileset lives in a subdirectory next to its image, the map is only read from the reader
+	dir := writeTestFiles(t, fstest.MapFS{
+		"tilesets/tiles.tsx": {Data: []byte(testTSX(""))},
+		"tilesets/tiles.png": {Data: tilesetPNG(testTileColumns, testTileCount/testTileColumns, testTileSize, testTileSize)},
+	})
+
+	tmx := strings.Replace(testTMX(2, 1, csvLayer(1, "ground", 2, 1, 1, 6)), `source="tiles.tsx"`, `source="tilesets/tiles.tsx"`, 1)
+	gameMap, err := LoadFromReader(strings.NewReader(tmx), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tileset := gameMap.Tilesets[0]; tileset.TileCount != testTileCount || tileset.TilesetEbitenImage == nil {
+		t.Fatalf("tileset loaded with %d tiles and image %v", tileset.TileCount, tileset.TilesetEbitenImage)
+	}
+	if got := pixelAt(gameMap.Layers[0].render(gameMap, false), 24, 8); got != tileColor(5) {
+		t.Errorf("tile 5 renders %v, want %v", got, tileColor(5))
+	}
+
+	if _, err := LoadFromReader(strings.NewReader(tmx), t.TempDir()); err == nil {
+		t.Error("loading with a base dir lacking the tileset succeeded")
+	}
+}
+
+func TestTilesetLoadFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"assets/tiles.tsx": {Data: []byte(testTSX(""))},
+		"assets/tiles.png": {Data: tilesetPNG(testTileColumns, testTileCount/testTileColumns, testTileSize, testTileSize)},
+	}
+
+	tileset := &Tileset{FirstGid: 1, Source: "tiles.tsx"}
+	if err := tileset.LoadFromFS(fsys, "assets"); err != nil {
+		t.Fatal(err)
+	}
+	if tileset.Name != "tiles" || tileset.TileCount != testTileCount || len(tileset.Tiles) != testTileCount {
+		t.Errorf("tileset '%s' loaded with %d of %d tiles", tileset.Name, len(tileset.Tiles), tileset.TileCount)
+	}
+
+	missing := &Tileset{FirstGid: 1, Source: "missing.tsx"}
+	err := missing.LoadFromFS(fsys, "assets")
+	if err == nil || !strings.Contains(err.Error(), "missing.tsx") {
+		t.Errorf("loading a missing tsx gave %v, want an error naming it", err)
+	}
+}
@@ -4,5 +4,7 @@ go 1.16
 
 require (
 	github.com/hajimehoshi/ebiten/v2 v2.1.1
+	github.com/klauspost/compress v1.13.6
 	github.com/rs/zerolog v1.21.0
+	golang.org/x/image v0.0.0-20210220032944-ac19c3e999fb
 )
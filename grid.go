@@ -0,0 +1,44 @@
+package ebitmx
+
+import "image"
+
+// GridOption configures Layer.TileGrid
+type GridOption func(*gridOptions)
+
+type gridOptions struct {
+	empty uint32
+}
+
+// WithEmptyValue sets the value TileGrid uses for empty cells, 0 by default
+func WithEmptyValue(empty uint32) GridOption {
+	return func(o *gridOptions) {
+		o.empty = empty
+	}
+}
+
+// TileGrid returns the global tile ids of the layer as a dense grid covering the layer's Bounds.
+// The grid is indexed by [y-Bounds().Min.Y][x-Bounds().Min.X], which is [y][x] for finite maps.
+func (l *Layer) TileGrid(opts ...GridOption) [][]uint32 {
+	o := gridOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	bounds := l.Bounds()
+	grid := make([][]uint32, bounds.Dy())
+	for y := range grid {
+		grid[y] = make([]uint32, bounds.Dx())
+		if o.empty != 0 {
+			for x := range grid[y] {
+				grid[y][x] = o.empty
+			}
+		}
+	}
+	l.ensureDecoded()
+	for _, tile := range l.Tiles {
+		if image.Pt(tile.X, tile.Y).In(bounds) {
+			grid[tile.Y-bounds.Min.Y][tile.X-bounds.Min.X] = tile.GlobalTileID
+		}
+	}
+	return grid
+}
@@ -0,0 +1,18 @@
+package ebitmx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTileGridEmptyValue(t *testing.T) {
+	layer := loadTestMap(t, testTMX(3, 2, csvLayer(1, "ground", 3, 2, 1, 0, 3, 0, 5|FLIPPED_VERTICALLY_FLAG, 0))).Layers[0]
+
+	if got, want := layer.TileGrid(), [][]uint32{{1, 0, 3}, {0, 5, 0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("grid is %v, want %v", got, want)
+	}
+	const empty = ^uint32(0)
+	if got, want := layer.TileGrid(WithEmptyValue(empty)), [][]uint32{{1, empty, 3}, {empty, 5, empty}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("grid with a custom empty value is %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package ebitmx
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// ImageSource is an <image> element that either references a file or embeds the image data
+type ImageSource struct {
+	Text   string     `xml:",chardata"`
+	Format string     `xml:"format,attr,omitempty"`
+	Source string     `xml:"source,attr,omitempty"`
+	Width  int        `xml:"width,attr,omitempty"`
+	Height int        `xml:"height,attr,omitempty"`
+	Data   *ImageData `xml:"data"`
+}
+
+type ImageData struct {
+	Text        string       `xml:",chardata"`
+	Encoding    DataEncoding `xml:"encoding,attr"`
+	Compression Compression  `xml:"compression,attr,omitempty"`
+}
+
+// Load decodes the image, resolving a file source relative to dir
+func (i *ImageSource) Load(dir string) (*ebiten.Image, image.Image, error) {
+	return i.load(nil, dir, defaultMaxDecompressedSize)
+}
+
+// load decodes the image, reading a file source from fsys or the OS if fsys is nil.
+// Embedded image data may inflate to at most limit bytes, see WithMaxDecompressedSize.
+func (i *ImageSource) load(fsys fs.FS, dir string, limit int64) (*ebiten.Image, image.Image, error) {
+	var data []byte
+	if i.Data != nil {
+		if i.Data.Encoding != Base64 {
+			return nil, nil, errors.New("unsupported embedded image encoding '" + string(i.Data.Encoding) + "'")
+		}
+		decoded, err := decodeBase64(i.Data.Text, i.Data.Compression, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = decoded
+	} else {
+		imgPath, err := resolveFile(fsys, dir, i.Source)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err = readFile(fsys, imgPath)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ebiten.NewImageFromImage(img), img, nil
+}
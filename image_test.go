@@ -0,0 +1,67 @@
+package ebitmx
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedTilesetImage(t *testing.T) {
+	fsys := newTestFS(testTMX(1, 1, csvLayer(1, "ground", 1, 1, 6)))
+	fsys["tiles.tsx"].Data = []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.8" tiledversion="1.8.2" name="tiles" tilewidth="16" tileheight="16" tilecount="16" columns="4">
+ <image format="png" width="64" height="64">
+  <data encoding="base64">%s</data>
+ </image>
+</tileset>
+`, base64.StdEncoding.EncodeToString(fsys["tiles.png"].Data)))
+	delete(fsys, "tiles.png")
+	gameMap := loadTestMapFS(t, fsys)
+
+	tileset := gameMap.Tilesets[0]
+	if len(tileset.Tiles) != testTileCount {
+		t.Fatalf("tileset has %d tiles, want %d", len(tileset.Tiles), testTileCount)
+	}
+	if got := pixelAt(tileset.Tiles[5], tileset.Tiles[5].Bounds().Min.X+8, tileset.Tiles[5].Bounds().Min.Y+8); got != tileColor(5) {
+		t.Errorf("tile 5 has color %v, want %v", got, tileColor(5))
+	}
+}
+
+func TestEmbeddedImageMaxDecompressedSize(t *testing.T) {
+	png := tilesetPNG(testTileColumns, testTileCount/testTileColumns, testTileSize, testTileSize)
+	compressed, err := compressLevel(png, Gzip, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := fmt.Sprintf(`<data encoding="base64" compression="gzip">%s</data>`, base64.StdEncoding.EncodeToString(compressed))
+
+	tileset := newTestFS(testTMX(1, 1, csvLayer(1, "ground", 1, 1, 6)))
+	tileset["tiles.tsx"].Data = []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.8" tiledversion="1.8.2" name="tiles" tilewidth="16" tileheight="16" tilecount="16" columns="4">
+ <image format="png" width="64" height="64">
+  %s
+ </image>
+</tileset>
+`, data))
+	imageLayer := newTestFS(testTMX(1, 1, fmt.Sprintf(` <imagelayer id="1" name="sky">
+  <image format="png" width="64" height="64">
+   %s
+  </image>
+ </imagelayer>
+`, data)))
+
+	for _, test := range []struct {
+		name string
+		fsys fstest.MapFS
+	}{{"tileset", tileset}, {"image layer", imageLayer}} {
+		if _, err := LoadFromFS(test.fsys, "map.tmx"); err != nil {
+			t.Errorf("%s: loading within the default limit failed: %s", test.name, err)
+		}
+		_, err := LoadFromFS(test.fsys, "map.tmx", WithMaxDecompressedSize(int64(len(png)-1)))
+		if !errors.Is(err, ErrDecompressedSizeExceeded) {
+			t.Errorf("%s: loading an over-limit image gave %v, want ErrDecompressedSizeExceeded", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package ebitmx
+
+import (
+	"encoding/xml"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// ImageLayer is a layer showing a single image, e.g. a background, optionally repeated along the axes
+type ImageLayer struct {
+	ID         uint         `xml:"id,attr"`
+	Name       string       `xml:"name,attr,omitempty"`
+	Class      string       `xml:"class,attr,omitempty"`
+	Offsetx    int          `xml:"offsetx,attr,omitempty"`
+	Offsety    int          `xml:"offsety,attr,omitempty"`
+	Opacity    float64      `xml:"opacity,attr"`
+	Visible    Visibility   `xml:"visible,attr"`
+	Tintcolor  string       `xml:"tintcolor,attr,omitempty"`
+	RepeatX    bool         `xml:"repeatx,attr,omitempty"`
+	RepeatY    bool         `xml:"repeaty,attr,omitempty"`
+	Properties Properties   `xml:"properties"`
+	Image      *ImageSource `xml:"image"`
+
+	// EbitenImage is the loaded image, nil if the layer has none
+	EbitenImage *ebiten.Image `xml:"-"`
+	Rendered    *ebiten.Image `xml:"-"`
+}
+
+func (l *ImageLayer) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	// Tiled omits the opacity when it is 1 and visible when it's true
+	type imageLayer ImageLayer
+	decoded := imageLayer{Opacity: 1, Visible: true}
+	if err := d.DecodeElement(&decoded, &start); err != nil {
+		return err
+	}
+	*l = ImageLayer(decoded)
+	return nil
+}
+
+// Render returns the camera view of the layer's image placed at the layer offset, repeated if enabled.
+// The render is cached until refresh is set or Invalidate is called.
+func (l *ImageLayer) Render(gameMap *TmxMap, scale float64, refresh bool) *ebiten.Image {
+	return l.render(gameMap, refresh).SubImage(gameMap.UpdateScaledCam(scale)).(*ebiten.Image)
+}
+
+// render returns the cached render of the whole layer, rebuilding it if needed
+func (l *ImageLayer) render(gameMap *TmxMap, refresh bool) *ebiten.Image {
+	if l.Rendered == nil || refresh {
+		l.Invalidate()
+		rendered := ebiten.NewImage(gameMap.PixelWidth, gameMap.PixelHeight)
+		if l.EbitenImage != nil {
+			op := &ebiten.DrawImageOptions{}
+			op.ColorM.Scale(1, 1, 1, l.Opacity)
+			if tint, err := parseColor(l.Tintcolor); err == nil {
+				op.ColorM.Scale(float64(tint.R)/0xff, float64(tint.G)/0xff, float64(tint.B)/0xff, float64(tint.A)/0xff)
+			}
+
+			w, h := l.EbitenImage.Size()
+			for _, y := range repeatPositions(l.Offsety, h, gameMap.PixelHeight, l.RepeatY) {
+				for _, x := range repeatPositions(l.Offsetx, w, gameMap.PixelWidth, l.RepeatX) {
+					op.GeoM.Reset()
+					op.GeoM.Translate(float64(x), float64(y))
+					rendered.DrawImage(l.EbitenImage, op)
+				}
+			}
+		}
+		l.Rendered = rendered
+	}
+
+	return l.Rendered
+}
+
+// Invalidate drops the cached render, so the next Render rebuilds it
+func (l *ImageLayer) Invalidate() {
+	if l.Rendered != nil {
+		l.Rendered.Dispose()
+		l.Rendered = nil
+	}
+}
+
+// repeatPositions returns the positions an image of the given size is drawn at along one axis
+// of length total, starting from offset and covering the whole axis if repeat is set
+func repeatPositions(offset, size, total int, repeat bool) []int {
+	if !repeat || size <= 0 {
+		return []int{offset}
+	}
+
+	var positions []int
+	start := offset % size
+	if start > 0 {
+		start -= size
+	}
+	for pos := start; pos < total; pos += size {
+		positions = append(positions, pos)
+	}
+	return positions
+}
@@ -0,0 +1,187 @@
+package ebitmx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Reading pixels back from ebiten images requires the game loop, so the tests run within Update
+var regularTermination = errors.New("regular termination")
+
+type testGame struct {
+	m    *testing.M
+	code int
+}
+
+func (g *testGame) Update() error {
+	g.code = g.m.Run()
+	return regularTermination
+}
+
+func (*testGame) Draw(*ebiten.Image) {}
+
+func (*testGame) Layout(int, int) (int, int) {
+	return 320, 240
+}
+
+func TestMain(m *testing.M) {
+	g := &testGame{m: m}
+	if err := ebiten.RunGame(g); err != nil && err != regularTermination {
+		panic(err)
+	}
+	os.Exit(g.code)
+}
+
+// The test tileset tiles.tsx has 4x4 tiles of 16x16 pixels. Every tile is filled with tileColor
+// and has a white marker pixel in its top left corner to tell flips apart.
+const (
+	testTileSize    = 16
+	testTileColumns = 4
+	testTileCount   = 16
+)
+
+var white = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+
+// tileColor returns the fill color of the tile with the given internal id
+func tileColor(id int) color.RGBA {
+	return color.RGBA{R: uint8(0x10 + 0x30*(id%4)), G: uint8(0x10 + 0x30*(id/4)), B: 0x80, A: 0xff}
+}
+
+// tilesetPNG encodes a tileset image of columns x rows tiles, see tileColor
+func tilesetPNG(columns, rows, tileWidth, tileHeight int) []byte {
+	return encodePNG(tilesetImage(columns, rows, tileWidth, tileHeight))
+}
+
+// tilesetImage returns a tileset image of columns x rows tiles, see tileColor
+func tilesetImage(columns, rows, tileWidth, tileHeight int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, columns*tileWidth, rows*tileHeight))
+	for id := 0; id < columns*rows; id++ {
+		x0, y0 := (id%columns)*tileWidth, (id/columns)*tileHeight
+		for y := y0; y < y0+tileHeight; y++ {
+			for x := x0; x < x0+tileWidth; x++ {
+				img.SetRGBA(x, y, tileColor(id))
+			}
+		}
+		img.SetRGBA(x0, y0, white)
+	}
+	return img
+}
+
+// testTileset returns the test tileset built in code instead of loaded from tiles.tsx
+func testTileset() *Tileset {
+	img := tilesetImage(testTileColumns, testTileCount/testTileColumns, testTileSize, testTileSize)
+	return &Tileset{
+		Name:               "tiles",
+		TileWidth:          testTileSize,
+		TileHeight:         testTileSize,
+		TileCount:          testTileCount,
+		Columns:            testTileColumns,
+		TilesetImage:       img,
+		TilesetEbitenImage: ebiten.NewImageFromImage(img),
+	}
+}
+
+func encodePNG(img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// testTSX returns the TSX of a tileset using tiles.png, extra is inserted after the image element
+func testTSX(extra string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.8" tiledversion="1.8.2" name="tiles" tilewidth="%[1]d" tileheight="%[1]d" tilecount="%[2]d" columns="%[3]d">
+ <image source="tiles.png" width="%[4]d" height="%[4]d"/>
+%[5]s</tileset>
+`, testTileSize, testTileCount, testTileColumns, testTileSize*testTileColumns, extra)
+}
+
+// testTMX returns an orthogonal map of the given size with 16x16 tiles using tiles.tsx at firstgid 1
+func testTMX(width, height int, body string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<map version="1.8" tiledversion="1.8.2" orientation="orthogonal" renderorder="right-down" width="%d" height="%d" tilewidth="%d" tileheight="%d" infinite="0" nextlayerid="10" nextobjectid="10">
+ <tileset firstgid="1" source="tiles.tsx"/>
+%s</map>
+`, width, height, testTileSize, testTileSize, body)
+}
+
+// csvLayer returns a layer element with the given gids as CSV data
+func csvLayer(id int, name string, width, height int, gids ...uint32) string {
+	values := make([]string, len(gids))
+	for i, gid := range gids {
+		values[i] = fmt.Sprint(gid)
+	}
+	return fmt.Sprintf(` <layer id="%d" name="%s" width="%d" height="%d">
+  <data encoding="csv">%s</data>
+ </layer>
+`, id, name, width, height, strings.Join(values, ","))
+}
+
+// newTestFS returns a file system holding map.tmx along with the test tileset
+func newTestFS(tmx string) fstest.MapFS {
+	return fstest.MapFS{
+		"map.tmx":   {Data: []byte(tmx)},
+		"tiles.tsx": {Data: []byte(testTSX(""))},
+		"tiles.png": {Data: tilesetPNG(testTileColumns, testTileCount/testTileColumns, testTileSize, testTileSize)},
+	}
+}
+
+// loadTestMap loads the map from a test file system, see newTestFS
+func loadTestMap(t testing.TB, tmx string, opts ...LoadOption) *TmxMap {
+	t.Helper()
+	return loadTestMapFS(t, newTestFS(tmx), opts...)
+}
+
+func loadTestMapFS(t testing.TB, fsys fstest.MapFS, opts ...LoadOption) *TmxMap {
+	t.Helper()
+	gameMap, err := LoadFromFS(fsys, "map.tmx", opts...)
+	if err != nil {
+		t.Fatalf("failed loading map: %s", err)
+	}
+	return gameMap
+}
+
+// writeTestFiles writes the files of fsys to a temporary directory and returns it
+func writeTestFiles(t testing.TB, fsys fstest.MapFS) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, file := range fsys {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, file.Data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// pixelAt returns the premultiplied color of img at x, y
+func pixelAt(img *ebiten.Image, x, y int) color.RGBA {
+	return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+}
+
+// isDisposed reports whether img was disposed, ebiten panics when asking a disposed image for its bounds
+func isDisposed(img *ebiten.Image) (disposed bool) {
+	defer func() {
+		if recover() != nil {
+			disposed = true
+		}
+	}()
+	img.Bounds()
+	return false
+}
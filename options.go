@@ -0,0 +1,107 @@
+package ebitmx
+
+import (
+	"io/fs"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// LoadOption configures optional behaviour of LoadFromFile
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	rawGIDs bool
+	stats   *LoadStats
+
+	tileDrawHook func(*Tile, *ebiten.DrawImageOptions)
+	maxChunks    int
+
+	missingTilePlaceholders bool
+	lazyDecode              bool
+	sourceResolver          func(string) string
+	maxDecompressedSize     int64
+	tileGrid                bool
+	// fsys is the file system files are read from, the OS if nil, see LoadFromFS
+	fsys fs.FS
+}
+
+func newLoadOptions(opts []LoadOption) loadOptions {
+	o := loadOptions{maxChunks: defaultMaxChunks, maxDecompressedSize: defaultMaxDecompressedSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithRawGIDs keeps the flip flags in Tile.GlobalTileID instead of stripping them
+// and skips decoding them into the Flipped* booleans.
+// Tileset resolution and InternalTileID still use the gid without the flag bits,
+// so tiles resolve to the same tileset either way, but they are rendered unflipped.
+func WithRawGIDs() LoadOption {
+	return func(o *loadOptions) {
+		o.rawGIDs = true
+	}
+}
+
+// WithTileDrawHook registers a function called for every tile drawn by Layer.Render.
+// The options already contain the tile's placement, the hook may adjust them further,
+// e.g. to apply a tint based on the tile's tileset properties (see Tile.Definition).
+func WithTileDrawHook(hook func(tile *Tile, op *ebiten.DrawImageOptions)) LoadOption {
+	return func(o *loadOptions) {
+		o.tileDrawHook = hook
+	}
+}
+
+// WithChunkCache limits how many rendered chunks Layer.DrawChunked keeps cached across all layers.
+// The least recently used chunks are disposed when the limit is exceeded.
+func WithChunkCache(maxChunks int) LoadOption {
+	return func(o *loadOptions) {
+		o.maxChunks = maxChunks
+	}
+}
+
+// WithMissingTilePlaceholders logs gids no tileset owns instead of failing the load
+// and renders a magenta placeholder in their cells
+func WithMissingTilePlaceholders() LoadOption {
+	return func(o *loadOptions) {
+		o.missingTilePlaceholders = true
+	}
+}
+
+// WithLazyDecode defers decoding the tile data of each layer until the layer is first rendered
+// or queried through its methods or the map's. Until then the layer's Tiles are empty.
+// Decoding errors are logged instead of being returned by LoadFromFile.
+func WithLazyDecode() LoadOption {
+	return func(o *loadOptions) {
+		o.lazyDecode = true
+	}
+}
+
+// WithTilesetSourceResolver remaps the sources of tilesets and their images before they are resolved
+// relative to the referencing file, e.g. to point them at a packed atlas
+func WithTilesetSourceResolver(resolver func(source string) string) LoadOption {
+	return func(o *loadOptions) {
+		o.sourceResolver = resolver
+	}
+}
+
+// WithMaxDecompressedSize limits how many bytes compressed layer data and embedded images may inflate to, protecting
+// against decompression bombs in untrusted maps. Loading fails with ErrDecompressedSizeExceeded
+// beyond the limit. The default is 256 MiB, a limit <= 0 disables the check.
+func WithMaxDecompressedSize(bytes int64) LoadOption {
+	return func(o *loadOptions) {
+		// -1 keeps a disabled check apart from the unset limit of tilesets loaded on their own
+		if bytes <= 0 {
+			bytes = -1
+		}
+		o.maxDecompressedSize = bytes
+	}
+}
+
+// WithTileGrid indexes the tiles of each layer by cell after decoding, so tile lookups by cell
+// take constant time instead of scanning the layer. It costs a pointer per cell of every layer.
+func WithTileGrid() LoadOption {
+	return func(o *loadOptions) {
+		o.tileGrid = true
+	}
+}
@@ -0,0 +1,85 @@
+package ebitmx
+
+import "image"
+
+// TileToPixel returns the top left corner of the bounding box of the cell at x, y in map pixels,
+// according to the map orientation
+func (t *TmxMap) TileToPixel(x, y int) image.Point {
+	switch t.Orientation {
+	case Isometric:
+		// the diamond of the top left cell is centered horizontally over the left half of the map
+		return image.Pt((x-y+t.Height-1)*t.TileWidth/2, (x+y)*t.TileHeight/2)
+	case Staggered, Hexagonal:
+		s := t.stagger()
+		if s.axisX {
+			p := image.Pt(x*s.columnWidth, y*(t.TileHeight+s.sideLengthY))
+			if s.staggered(x) {
+				p.Y += s.rowHeight
+			}
+			return p
+		}
+		p := image.Pt(x*(t.TileWidth+s.sideLengthX), y*s.rowHeight)
+		if s.staggered(y) {
+			p.X += s.columnWidth
+		}
+		return p
+	}
+	return image.Pt(x*t.TileWidth, y*t.TileHeight)
+}
+
+// staggerGeometry describes the cell layout of staggered and hexagonal maps like Tiled computes it.
+// Staggered maps are hexagonal maps with a side length of 0.
+type staggerGeometry struct {
+	axisX                    bool
+	even                     bool
+	sideLengthX, sideLengthY int
+	sideOffsetX, sideOffsetY int
+	columnWidth, rowHeight   int
+}
+
+func (t *TmxMap) stagger() staggerGeometry {
+	s := staggerGeometry{
+		axisX: t.StaggerAxis == StaggerAxisX,
+		even:  t.StaggerIndex == StaggerIndexEven,
+	}
+	if t.Orientation == Hexagonal {
+		if s.axisX {
+			s.sideLengthX = t.HexSideLength
+		} else {
+			s.sideLengthY = t.HexSideLength
+		}
+	}
+	s.sideOffsetX = (t.TileWidth - s.sideLengthX) / 2
+	s.sideOffsetY = (t.TileHeight - s.sideLengthY) / 2
+	s.columnWidth = s.sideOffsetX + s.sideLengthX
+	s.rowHeight = s.sideOffsetY + s.sideLengthY
+	return s
+}
+
+// staggered reports whether the column or row with the given index along the stagger axis is shifted
+func (s staggerGeometry) staggered(i int) bool {
+	return (i%2 != 0) != s.even
+}
+
+// pixelSize returns the size of the whole map in pixels according to the map orientation
+func (t *TmxMap) pixelSize() (int, int) {
+	switch t.Orientation {
+	case Isometric:
+		return (t.Width + t.Height) * t.TileWidth / 2, (t.Width + t.Height) * t.TileHeight / 2
+	case Staggered, Hexagonal:
+		s := t.stagger()
+		if s.axisX {
+			height := t.Height * (t.TileHeight + s.sideLengthY)
+			if t.Width > 1 {
+				height += s.rowHeight
+			}
+			return t.Width*s.columnWidth + s.sideOffsetX, height
+		}
+		width := t.Width * (t.TileWidth + s.sideLengthX)
+		if t.Height > 1 {
+			width += s.columnWidth
+		}
+		return width, t.Height*s.rowHeight + s.sideOffsetY
+	}
+	return t.Width * t.TileWidth, t.Height * t.TileHeight
+}
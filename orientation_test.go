@@ -0,0 +1,59 @@
+package ebitmx
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestIsometricPositions(t *testing.T) {
+	gameMap := &TmxMap{Orientation: Isometric, Width: 3, Height: 2, TileWidth: 32, TileHeight: 16}
+	for _, test := range []struct {
+		x, y int
+		want image.Point
+	}{
+		{0, 0, image.Pt(16, 0)},
+		{1, 0, image.Pt(32, 8)},
+		{0, 1, image.Pt(0, 8)},
+		{2, 1, image.Pt(32, 24)},
+	} {
+		if got := gameMap.TileToPixel(test.x, test.y); got != test.want {
+			t.Errorf("cell %d,%d is at %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+	if w, h := gameMap.pixelSize(); w != 80 || h != 40 {
+		t.Errorf("isometric map has size %dx%d, want 80x40", w, h)
+	}
+
+	tmx := strings.Replace(testTMX(3, 2, csvLayer(1, "ground", 3, 2, 0, 0, 0, 0, 0, 1)), `orientation="orthogonal"`, `orientation="isometric"`, 1)
+	tmx = strings.Replace(tmx, `tilewidth="16" tileheight="16"`, `tilewidth="32" tileheight="16"`, 1)
+	loaded := loadTestMap(t, tmx)
+	rendered := loaded.Layers[0].render(loaded, false)
+	if size := rendered.Bounds().Size(); size != image.Pt(80, 40) {
+		t.Errorf("render has size %v, want 80x40", size)
+	}
+	if got := pixelAt(rendered, 32, 24); got != white {
+		t.Errorf("marker of the tile in cell 2,1 isn't at 32,24, found %v", got)
+	}
+}
+
+func TestStaggeredPositions(t *testing.T) {
+	staggered := &TmxMap{Orientation: Staggered, StaggerAxis: StaggerAxisY, StaggerIndex: StaggerIndexOdd,
+		Width: 4, Height: 4, TileWidth: 32, TileHeight: 16}
+	for y, want := range []image.Point{{0, 0}, {16, 8}, {0, 16}, {16, 24}} {
+		if got := staggered.TileToPixel(0, y); got != want {
+			t.Errorf("staggered row %d starts at %v, want %v", y, got, want)
+		}
+	}
+	if got := staggered.TileToPixel(1, 1); got != image.Pt(48, 8) {
+		t.Errorf("staggered cell 1,1 is at %v, want (48,8)", got)
+	}
+
+	hexagonal := &TmxMap{Orientation: Hexagonal, StaggerAxis: StaggerAxisX, StaggerIndex: StaggerIndexEven, HexSideLength: 8,
+		Width: 4, Height: 2, TileWidth: 32, TileHeight: 32}
+	for x, want := range []image.Point{{0, 16}, {20, 0}, {40, 16}, {60, 0}} {
+		if got := hexagonal.TileToPixel(x, 0); got != want {
+			t.Errorf("hexagonal column %d starts at %v, want %v", x, got, want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package ebitmx
+
+import (
+	"encoding/xml"
+	"image/color"
+	"strconv"
+)
+
+// Property is a single custom property as defined in Tiled.
+// Type is one of string, int, float, bool, color, file or object, empty meaning string.
+type Property struct {
+	Name  string `xml:"name,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:"value,attr"`
+	Text  string `xml:",chardata"`
+}
+
+// Properties maps property names to their values
+type Properties map[string]Property
+
+func (p *Properties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw struct {
+		Properties []Property `xml:"property"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	*p = make(Properties, len(raw.Properties))
+	for _, prop := range raw.Properties {
+		// multi-line strings are stored as element text instead of the value attribute
+		if prop.Value == "" {
+			prop.Value = prop.Text
+		}
+		(*p)[prop.Name] = prop
+	}
+	return nil
+}
+
+// GetString returns the raw value of the named property
+func (p Properties) GetString(name string) (string, bool) {
+	prop, ok := p[name]
+	return prop.Value, ok
+}
+
+// GetInt returns the named property as an int, ok is false if it's missing or not an integer
+func (p Properties) GetInt(name string) (int, bool) {
+	prop, ok := p[name]
+	if !ok {
+		return 0, false
+	}
+	value, err := strconv.Atoi(prop.Value)
+	return value, err == nil
+}
+
+// GetFloat returns the named property as a float64, ok is false if it's missing or not a number
+func (p Properties) GetFloat(name string) (float64, bool) {
+	prop, ok := p[name]
+	if !ok {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(prop.Value, 64)
+	return value, err == nil
+}
+
+// GetBool returns the named property as a bool, ok is false if it's missing or not a boolean
+func (p Properties) GetBool(name string) (bool, bool) {
+	prop, ok := p[name]
+	if !ok {
+		return false, false
+	}
+	value, err := strconv.ParseBool(prop.Value)
+	return value, err == nil
+}
+
+// GetColor returns the named color property, ok is false if it's missing, empty or not a color
+func (p Properties) GetColor(name string) (color.NRGBA, bool) {
+	prop, ok := p[name]
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	value, err := parseColor(prop.Value)
+	return value, err == nil
+}
@@ -0,0 +1,77 @@
+package ebitmx
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestPropertyTypes(t *testing.T) {
+	tmx := strings.Replace(testTMX(1, 1, ` <layer id="1" name="ground" width="1" height="1">
+  <properties>
+   <property name="depth" type="int" value="-3"/>
+  </properties>
+  <data encoding="csv">1</data>
+ </layer>
+ <objectgroup id="2" name="objects">
+  <properties>
+   <property name="solid" type="bool" value="true"/>
+  </properties>
+  <object id="1" x="0" y="0">
+   <properties>
+    <property name="speed" type="float" value="1.5"/>
+    <property name="note">first line
+second line</property>
+   </properties>
+  </object>
+ </objectgroup>
+`), ` <tileset`, ` <properties>
+  <property name="title" value="Cave"/>
+  <property name="fog" type="color" value="#80102030"/>
+ </properties>
+ <tileset`, 1)
+	fsys := newTestFS(tmx)
+	fsys["tiles.tsx"].Data = []byte(strings.Replace(testTSX(` <tile id="0">
+  <properties>
+   <property name="damage" type="int" value="7"/>
+  </properties>
+ </tile>
+`), ` <image`, ` <properties>
+  <property name="ambient" type="color" value="#ff8000"/>
+ </properties>
+ <image`, 1))
+	gameMap := loadTestMapFS(t, fsys)
+
+	if title, ok := gameMap.Properties.GetString("title"); !ok || title != "Cave" {
+		t.Errorf("string property '%s' (%t), want Cave", title, ok)
+	}
+	if fog, ok := gameMap.Properties.GetColor("fog"); !ok || fog != (color.NRGBA{R: 0x10, G: 0x20, B: 0x30, A: 0x80}) {
+		t.Errorf("8 digit color property %v (%t)", fog, ok)
+	}
+	if depth, ok := gameMap.Layers[0].Properties.GetInt("depth"); !ok || depth != -3 {
+		t.Errorf("int property %d (%t), want -3", depth, ok)
+	}
+	group := gameMap.ObjectGroups[0]
+	if solid, ok := group.Properties.GetBool("solid"); !ok || !solid {
+		t.Errorf("bool property %t (%t), want true", solid, ok)
+	}
+	if speed, ok := group.Objects[0].Properties.GetFloat("speed"); !ok || speed != 1.5 {
+		t.Errorf("float property %g (%t), want 1.5", speed, ok)
+	}
+	if note, _ := group.Objects[0].Properties.GetString("note"); note != "first line\nsecond line" {
+		t.Errorf("multi-line string property %q", note)
+	}
+	if ambient, ok := gameMap.Tilesets[0].Properties.GetColor("ambient"); !ok || ambient != (color.NRGBA{R: 0xff, G: 0x80, A: 0xff}) {
+		t.Errorf("6 digit color property %v (%t)", ambient, ok)
+	}
+	if damage, ok := gameMap.Layers[0].Tiles[0].Properties().GetInt("damage"); !ok || damage != 7 {
+		t.Errorf("tile property %d (%t), want 7", damage, ok)
+	}
+
+	if _, ok := gameMap.Properties.GetInt("title"); ok {
+		t.Error("string property converted to an int")
+	}
+	if _, ok := gameMap.Properties.GetBool("missing"); ok {
+		t.Error("found a missing property")
+	}
+}
@@ -0,0 +1,179 @@
+package ebitmx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+func (l *Layer) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	// Tiled omits the opacity when it is 1 and visible when it's true
+	type layer Layer
+	decoded := layer{Opacity: 1, Visible: true}
+	if err := d.DecodeElement(&decoded, &start); err != nil {
+		return err
+	}
+	*l = Layer(decoded)
+	l.dataHash = l.hashData()
+	return nil
+}
+
+// hashData returns a hash of the raw layer data, used to skip decoding unchanged layers on Reload
+func (l *Layer) hashData() uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%s\x00", l.Data.Encoding, l.Data.Compression)
+	h.Write([]byte(l.Data.Text))
+	for _, chunk := range l.Data.Chunks {
+		fmt.Fprintf(h, "\x00%d,%d,%d,%d\x00", chunk.X, chunk.Y, chunk.Width, chunk.Height)
+		h.Write([]byte(chunk.Text))
+	}
+	return h.Sum64()
+}
+
+// Tint returns the layer's tint color, ok is false if the layer has no valid tint
+func (l *Layer) Tint() (color.NRGBA, bool) {
+	if l.Tintcolor == "" {
+		return color.NRGBA{}, false
+	}
+	tint, err := parseColor(l.Tintcolor)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	return tint, true
+}
+
+// BackgroundRGBA returns the map's background color, transparent if it's unset or invalid.
+// The color is alpha-premultiplied, so it can be passed to ebiten.Image.Fill directly.
+func (t *TmxMap) BackgroundRGBA() color.RGBA {
+	if t.BackgroundColor == "" {
+		return color.RGBA{}
+	}
+	bg, err := parseColor(t.BackgroundColor)
+	if err != nil {
+		return color.RGBA{}
+	}
+	return color.RGBAModel.Convert(bg).(color.RGBA)
+}
+
+// parseColor parses a color as stored by Tiled, "#rrggbb" or "#aarrggbb"
+func parseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s'", s)
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color '%s'", s)
+	}
+	if len(hex) == 6 {
+		value |= 0xff000000
+	}
+	return color.NRGBA{
+		A: uint8(value >> 24),
+		R: uint8(value >> 16),
+		G: uint8(value >> 8),
+		B: uint8(value),
+	}, nil
+}
+
+// DrawTo draws the camera view of all visible tile and image layers onto dst in document order, scaled by scale.
+// Layer opacity is applied by the layers' renders.
+func (t *TmxMap) DrawTo(dst *ebiten.Image, scale float64) {
+	op := &ebiten.DrawImageOptions{}
+	for _, entry := range t.LayerStack {
+		if !entry.IsVisible() {
+			continue
+		}
+		op.GeoM.Reset()
+		op.GeoM.Scale(scale, scale)
+		switch {
+		case entry.Layer != nil:
+			dst.DrawImage(entry.Layer.Render(t, scale, false), op)
+		case entry.ImageLayer != nil:
+			dst.DrawImage(entry.ImageLayer.Render(t, scale, false), op)
+		}
+	}
+}
+
+// RenderFull composites all visible tile and image layers at full map extent into a new image,
+// scaled by scale, e.g. for minimaps or screenshots. The camera is ignored.
+func (t *TmxMap) RenderFull(scale float64) *ebiten.Image {
+	full := ebiten.NewImage(int(math.Ceil(float64(t.PixelWidth)*scale)), int(math.Ceil(float64(t.PixelHeight)*scale)))
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(scale, scale)
+	for _, entry := range t.LayerStack {
+		if !entry.IsVisible() {
+			continue
+		}
+		switch {
+		case entry.Layer != nil:
+			full.DrawImage(entry.Layer.render(t, false), op)
+		case entry.ImageLayer != nil:
+			full.DrawImage(entry.ImageLayer.render(t, false), op)
+		}
+	}
+	return full
+}
+
+// DrawToClipped works like DrawTo but only writes to the pixels of dst within clip,
+// e.g. for split-screen views. The map is positioned as with DrawTo, clip only masks it.
+func (t *TmxMap) DrawToClipped(dst *ebiten.Image, scale float64, clip image.Rectangle) {
+	t.DrawTo(dst.SubImage(clip).(*ebiten.Image), scale)
+}
+
+// flipGeoM returns the transformation applying the flip flags to a tile of the given size.
+// Like in Tiled the diagonal flip is applied first, followed by the horizontal and vertical flips.
+// The flipped tile covers the same area, with width and height swapped for diagonal flips.
+func flipGeoM(flags TileFlags, width, height float64) ebiten.GeoM {
+	var g ebiten.GeoM
+	if flags.Diagonal() {
+		g.SetElement(0, 0, 0)
+		g.SetElement(0, 1, 1)
+		g.SetElement(1, 0, 1)
+		g.SetElement(1, 1, 0)
+		width, height = height, width
+	}
+	if flags.Horizontal() {
+		g.Scale(-1, 1)
+		g.Translate(width, 0)
+	}
+	if flags.Vertical() {
+		g.Scale(1, -1)
+		g.Translate(0, height)
+	}
+	return g
+}
+
+// DrawTileByGID draws the tile with the given gid onto dst, applying its flip flags before op.
+// op may be nil.
+func (t *TmxMap) DrawTileByGID(dst *ebiten.Image, gid uint32, op *ebiten.DrawImageOptions) error {
+	id, flags := DecodeGID(gid)
+	tileset := t.TilesetForGID(id)
+	if tileset == nil {
+		return fmt.Errorf("couldn't find tileset for gid %d", id)
+	}
+	img := tileset.TileImage(int(id-tileset.FirstGid), t.animationTime)
+	if img == nil {
+		return fmt.Errorf("tileset '%s' has no tile for gid %d", tileset.Name, id)
+	}
+
+	drawOp := ebiten.DrawImageOptions{}
+	if op != nil {
+		drawOp = *op
+	}
+	size := img.Bounds().Size()
+	drawOp.GeoM = flipGeoM(flags, float64(size.X), float64(size.Y))
+	if op != nil {
+		drawOp.GeoM.Concat(op.GeoM)
+	}
+	dst.DrawImage(img, &drawOp)
+
+	return nil
+}
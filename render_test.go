@@ -0,0 +1,479 @@
+package ebitmx
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestTileDrawHook(t *testing.T) {
+	fsys := newTestFS(testTMX(3, 1, csvLayer(1, "ground", 3, 1, 1, 2, 3)))
+	fsys["tiles.tsx"].Data = []byte(testTSX(` <tile id="0">
+  <properties>
+   <property name="tint" type="color" value="#ffff0000"/>
+  </properties>
+ </tile>
+ <tile id="1">
+  <properties>
+   <property name="erase" type="bool" value="true"/>
+  </properties>
+ </tile>
+`))
+	gameMap := loadTestMapFS(t, fsys, WithTileDrawHook(func(tile *Tile, op *ebiten.DrawImageOptions) {
+		if tint, ok := tile.Properties().GetColor("tint"); ok {
+			op.ColorM.Scale(float64(tint.R)/0xff, float64(tint.G)/0xff, float64(tint.B)/0xff, 1)
+		}
+		if erase, _ := tile.Properties().GetBool("erase"); erase {
+			op.CompositeMode = ebiten.CompositeModeClear
+		}
+	}))
+	rendered := gameMap.Layers[0].render(gameMap, false)
+
+	c := tileColor(0)
+	if got, want := pixelAt(rendered, 8, 8), (color.RGBA{R: c.R, A: 0xff}); got != want {
+		t.Errorf("tinted tile has color %v, want %v", got, want)
+	}
+	if got := pixelAt(rendered, 24, 8); got.A != 0 {
+		t.Errorf("erased tile has color %v", got)
+	}
+	if got := pixelAt(rendered, 40, 8); got != tileColor(2) {
+		t.Errorf("tile after the erased one has color %v, want %v", got, tileColor(2))
+	}
+}
+
+func TestLargerTilesetTiles(t *testing.T) {
+	tmx := strings.NewReplacer(`tilewidth="16"`, `tilewidth="32"`, `tileheight="16"`, `tileheight="32"`).
+		Replace(testTMX(2, 2, csvLayer(1, "ground", 2, 2, 0, 0, 2, 0)))
+	fsys := newTestFS(tmx)
+	fsys["tiles.tsx"].Data = []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.8" tiledversion="1.8.2" name="big" tilewidth="48" tileheight="48" tilecount="4" columns="2">
+ <image source="tiles.png" width="96" height="96"/>
+</tileset>
+`)
+	fsys["tiles.png"].Data = tilesetPNG(2, 2, 48, 48)
+	gameMap := loadTestMapFS(t, fsys)
+
+	tileset := gameMap.Tilesets[0]
+	if tileset.TileWidth != 48 || tileset.TileHeight != 48 || tileset.Tiles[1].Bounds().Dx() != 48 {
+		t.Fatalf("tileset has %dx%d tiles", tileset.TileWidth, tileset.TileHeight)
+	}
+
+	// the tile is aligned to the bottom left of its cell at 0,32-64
+	rendered := gameMap.Layers[0].render(gameMap, false)
+	if got := pixelAt(rendered, 0, 16); got != white {
+		t.Errorf("top left corner of the tile has color %v, want the marker", got)
+	}
+	for _, p := range []image.Point{{47, 63}, {24, 40}} {
+		if got := pixelAt(rendered, p.X, p.Y); got != tileColor(1) {
+			t.Errorf("pixel %v has color %v, want %v", p, got, tileColor(1))
+		}
+	}
+	for _, p := range []image.Point{{0, 15}, {48, 40}} {
+		if got := pixelAt(rendered, p.X, p.Y); got.A != 0 {
+			t.Errorf("pixel %v outside of the tile has color %v", p, got)
+		}
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(1, 1, csvLayer(1, "ground", 1, 1, 1)))
+	layer := gameMap.Layers[0]
+	layer.render(gameMap, false)
+
+	replacement := ebiten.NewImage(16, 16)
+	replacement.Fill(white)
+	gameMap.Tilesets[0].OverrideTileImage(0, replacement)
+	if got := pixelAt(layer.render(gameMap, false), 8, 8); got != tileColor(0) {
+		t.Errorf("cached render changed to %v before Invalidate", got)
+	}
+
+	layer.Invalidate()
+	if layer.Rendered != nil {
+		t.Error("Invalidate kept the render")
+	}
+	if got := pixelAt(layer.render(gameMap, false), 8, 8); got != white {
+		t.Errorf("render after Invalidate has color %v, want the replacement", got)
+	}
+}
+
+func TestSemiTransparentLayers(t *testing.T) {
+	tmx := testTMX(1, 1, strings.Replace(csvLayer(1, "bottom", 1, 1, 1), `height="1"`, `height="1" opacity="0.5"`, 1)+
+		strings.Replace(csvLayer(2, "top", 1, 1, 6), `height="1"`, `height="1" opacity="0.5"`, 1))
+	gameMap := loadTestMap(t, tmx)
+	gameMap.CameraBounds = image.Rect(0, 0, 16, 16)
+	gameMap.CameraPosition = image.Pt(8, 8)
+
+	dst := ebiten.NewImage(16, 16)
+	gameMap.DrawTo(dst, 1)
+
+	// premultiplied source-over of top at 50% onto bottom at 50%
+	bottom, top := tileColor(0), tileColor(5)
+	blend := func(b, t uint8) float64 { return float64(t)*0.5 + float64(b)*0.5*0.5 }
+	want := [4]float64{blend(bottom.R, top.R), blend(bottom.G, top.G), blend(bottom.B, top.B), 0xff * 0.75}
+	got := pixelAt(dst, 8, 8)
+	for i, v := range [4]uint8{got.R, got.G, got.B, got.A} {
+		if math.Abs(float64(v)-want[i]) > 2 {
+			t.Errorf("composited color is %v, want about %v", got, want)
+			break
+		}
+	}
+}
+
+func TestRenderFull(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(2, 1, csvLayer(1, "left", 2, 1, 1, 0)+csvLayer(2, "right", 2, 1, 0, 6)))
+	// the camera is ignored
+	gameMap.CameraBounds = image.Rect(0, 0, 8, 8)
+
+	for _, scale := range []float64{1, 2} {
+		full := gameMap.RenderFull(scale)
+		if w, h := full.Size(); w != int(32*scale) || h != int(16*scale) {
+			t.Errorf("scale %g: full render is %dx%d", scale, w, h)
+		}
+		at := func(x, y int) color.RGBA { return pixelAt(full, int(float64(x)*scale), int(float64(y)*scale)) }
+		if got := at(8, 8); got != tileColor(0) {
+			t.Errorf("scale %g: left layer's tile has color %v, want %v", scale, got, tileColor(0))
+		}
+		if got := at(24, 8); got != tileColor(5) {
+			t.Errorf("scale %g: right layer's tile has color %v, want %v", scale, got, tileColor(5))
+		}
+		if got := at(16, 0); got != white {
+			t.Errorf("scale %g: right layer's marker has color %v", scale, got)
+		}
+	}
+}
+
+func TestHiddenLayer(t *testing.T) {
+	tmx := testTMX(1, 1, csvLayer(1, "ground", 1, 1, 1)+
+		strings.Replace(csvLayer(2, "hidden", 1, 1, 6), `height="1"`, `height="1" visible="0"`, 1))
+	gameMap := loadTestMap(t, tmx)
+	hidden := gameMap.Layers[1]
+	if hidden.Visible {
+		t.Fatal("layer with visible=\"0\" is visible")
+	}
+
+	if got := pixelAt(hidden.render(gameMap, false), 8, 8); got != (color.RGBA{}) {
+		t.Errorf("hidden layer renders color %v", got)
+	}
+	if got := pixelAt(gameMap.RenderFull(1), 8, 8); got != tileColor(0) {
+		t.Errorf("full render has color %v, want the ground's %v", got, tileColor(0))
+	}
+	gameMap.CameraBounds = image.Rect(0, 0, 16, 16)
+	gameMap.CameraPosition = image.Pt(8, 8)
+	dst := ebiten.NewImage(16, 16)
+	gameMap.DrawTo(dst, 1)
+	if got := pixelAt(dst, 8, 8); got != tileColor(0) {
+		t.Errorf("DrawTo drew color %v, want the ground's %v", got, tileColor(0))
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		s          string
+		want       color.NRGBA
+		background color.RGBA
+		valid      bool
+	}{
+		{"#ff8000", color.NRGBA{R: 0xff, G: 0x80, A: 0xff}, color.RGBA{R: 0xff, G: 0x80, A: 0xff}, true},
+		{"#80ff0000", color.NRGBA{R: 0xff, A: 0x80}, color.RGBA{R: 0x80, A: 0x80}, true},
+		{"", color.NRGBA{}, color.RGBA{}, false},
+	}
+	for _, test := range tests {
+		got, err := parseColor(test.s)
+		if valid := err == nil; valid != test.valid || got != test.want {
+			t.Errorf("parseColor(%q) = %v, %v, want %v and valid %t", test.s, got, err, test.want, test.valid)
+		}
+		gameMap := &TmxMap{BackgroundColor: test.s}
+		if bg := gameMap.BackgroundRGBA(); bg != test.background {
+			t.Errorf("background color %q is %v, want %v", test.s, bg, test.background)
+		}
+	}
+}
+
+func TestMissingTilePlaceholders(t *testing.T) {
+	tmx := testTMX(2, 1, csvLayer(1, "ground", 2, 1, 1, 99))
+	if _, err := LoadFromFS(newTestFS(tmx), "map.tmx"); err == nil {
+		t.Error("loading an unresolved gid without placeholders didn't fail")
+	}
+
+	var logged bytes.Buffer
+	defer func(logger zerolog.Logger) { log.Logger = logger }(log.Logger)
+	log.Logger = zerolog.New(&logged)
+
+	gameMap := loadTestMap(t, tmx, WithMissingTilePlaceholders())
+	if !strings.Contains(logged.String(), `"gid":99`) {
+		t.Errorf("unresolved gid wasn't logged: %s", logged.String())
+	}
+	rendered := gameMap.Layers[0].render(gameMap, false)
+	if got := pixelAt(rendered, 24, 8); got != (color.RGBA{R: 0xff, B: 0xff, A: 0xff}) {
+		t.Errorf("placeholder has color %v, want magenta", got)
+	}
+	if got := pixelAt(rendered, 8, 8); got != tileColor(0) {
+		t.Errorf("resolved tile has color %v", got)
+	}
+}
+
+func TestDrawTileByGID(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(1, 1, csvLayer(1, "ground", 1, 1, 0)))
+	dst := ebiten.NewImage(32, 16)
+
+	if err := gameMap.DrawTileByGID(dst, 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(16, 0)
+	if err := gameMap.DrawTileByGID(dst, 2|FLIPPED_HORIZONTALLY_FLAG, op); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []struct {
+		x, y int
+		want color.RGBA
+	}{{0, 0, white}, {8, 8, tileColor(0)}, {31, 0, white}, {16, 0, tileColor(1)}, {24, 8, tileColor(1)}} {
+		if got := pixelAt(dst, p.x, p.y); got != p.want {
+			t.Errorf("pixel %d,%d has color %v, want %v", p.x, p.y, got, p.want)
+		}
+	}
+	if err := gameMap.DrawTileByGID(dst, 99, nil); err == nil {
+		t.Error("drawing an unresolved gid didn't fail")
+	}
+}
+
+func TestOverrideTileImage(t *testing.T) {
+	gameMap := loadTestMap(t, testTMX(2, 1, csvLayer(1, "ground", 2, 1, 2, 3)))
+	tileset := gameMap.Tilesets[0]
+
+	red := color.RGBA{R: 0xff, A: 0xff}
+	replacement := ebiten.NewImage(16, 16)
+	replacement.Fill(red)
+	tileset.OverrideTileImage(1, replacement)
+
+	rendered := gameMap.Layers[0].render(gameMap, true)
+	if got := pixelAt(rendered, 8, 8); got != red {
+		t.Errorf("overridden tile has color %v, want %v", got, red)
+	}
+	if got := pixelAt(rendered, 24, 8); got != tileColor(2) {
+		t.Errorf("other tile has color %v, want %v", got, tileColor(2))
+	}
+
+	tileset.ClearTileOverride(1)
+	if got := pixelAt(gameMap.Layers[0].render(gameMap, true), 8, 8); got != tileColor(1) {
+		t.Errorf("tile has color %v after clearing the override, want %v", got, tileColor(1))
+	}
+}
+
+func TestDrawToClipped(t *testing.T) {
+	gids := make([]uint32, 16)
+	for i := range gids {
+		gids[i] = 1
+	}
+	gameMap := loadTestMap(t, testTMX(4, 4, csvLayer(1, "ground", 4, 4, gids...)))
+	gameMap.CameraBounds = image.Rect(0, 0, 64, 64)
+	gameMap.CameraPosition = image.Pt(32, 32)
+
+	red := color.RGBA{R: 0xff, A: 0xff}
+	dst := ebiten.NewImage(64, 64)
+	dst.Fill(red)
+	clip := image.Rect(16, 16, 48, 40)
+	gameMap.DrawToClipped(dst, 1, clip)
+
+	for y := 0; y < 64; y += 4 {
+		for x := 0; x < 64; x += 4 {
+			p := image.Pt(x+2, y+2)
+			want := red
+			if p.In(clip) {
+				want = tileColor(0)
+			}
+			if got := pixelAt(dst, p.X, p.Y); got != want {
+				t.Errorf("pixel %v has color %v, want %v", p, got, want)
+			}
+		}
+	}
+}
+
+func TestRenderFlipCombinations(t *testing.T) {
+	// tile 0 gets a red pixel next to its white marker to tell diagonal flips apart
+	red := color.RGBA{R: 0xff, A: 0xff}
+	img := tilesetImage(testTileColumns, testTileCount/testTileColumns, testTileSize, testTileSize)
+	img.SetRGBA(1, 0, red)
+
+	const h, v, d = FLIPPED_HORIZONTALLY_FLAG, FLIPPED_VERTICALLY_FLAG, FLIPPED_DIAGONALLY_FLAG
+	tests := []struct {
+		flags         uint32
+		marker, right image.Point
+	}{
+		{0, image.Pt(0, 0), image.Pt(1, 0)},
+		{h, image.Pt(15, 0), image.Pt(14, 0)},
+		{v, image.Pt(0, 15), image.Pt(1, 15)},
+		{h | v, image.Pt(15, 15), image.Pt(14, 15)},
+		{d, image.Pt(0, 0), image.Pt(0, 1)},
+		{d | h, image.Pt(15, 0), image.Pt(15, 1)},
+		{d | v, image.Pt(0, 15), image.Pt(0, 14)},
+		{d | h | v, image.Pt(15, 15), image.Pt(15, 14)},
+	}
+	gids := make([]uint32, len(tests))
+	for i, test := range tests {
+		gids[i] = 1 | test.flags
+	}
+	fsys := newTestFS(testTMX(len(gids), 1, csvLayer(1, "ground", len(gids), 1, gids...)))
+	fsys["tiles.png"].Data = encodePNG(img)
+	gameMap := loadTestMapFS(t, fsys)
+	rendered := gameMap.Layers[0].render(gameMap, false)
+
+	for i, test := range tests {
+		origin := image.Pt(i*testTileSize, 0)
+		if got := pixelAt(rendered, origin.X+test.marker.X, test.marker.Y); got != white {
+			t.Errorf("flags %#x: marker not at %v, found %v", test.flags, test.marker, got)
+		}
+		if got := pixelAt(rendered, origin.X+test.right.X, test.right.Y); got != red {
+			t.Errorf("flags %#x: red pixel not at %v, found %v", test.flags, test.right, got)
+		}
+	}
+}
+
+func TestLayerOpacity(t *testing.T) {
+	tmx := testTMX(1, 1, strings.Replace(csvLayer(1, "faded", 1, 1, 1), `height="1"`, `height="1" opacity="0.5"`, 1)+
+		csvLayer(2, "opaque", 1, 1, 1))
+	gameMap := loadTestMap(t, tmx)
+
+	if got := pixelAt(gameMap.Layers[0].render(gameMap, false), 8, 8); math.Abs(float64(got.A)-0xff*0.5) > 1 {
+		t.Errorf("layer at 0.5 opacity has alpha %d, want about %d", got.A, 0xff/2)
+	}
+	if got := pixelAt(gameMap.Layers[1].render(gameMap, false), 8, 8); got.A != 0xff {
+		t.Errorf("layer without opacity attribute has alpha %d, want 255", got.A)
+	}
+}
+
+func TestLayerTint(t *testing.T) {
+	img := tilesetImage(testTileColumns, testTileCount/testTileColumns, testTileSize, testTileSize)
+	draw.Draw(img, image.Rect(0, 0, 16, 16), image.NewUniform(white), image.Point{}, draw.Src)
+	tmx := testTMX(1, 1, strings.Replace(csvLayer(1, "tinted", 1, 1, 1), `height="1"`, `height="1" tintcolor="#ff0000"`, 1)+
+		csvLayer(2, "plain", 1, 1, 1))
+	fsys := newTestFS(tmx)
+	fsys["tiles.png"].Data = encodePNG(img)
+	gameMap := loadTestMapFS(t, fsys)
+
+	if got := pixelAt(gameMap.Layers[0].render(gameMap, false), 8, 8); got != (color.RGBA{R: 0xff, A: 0xff}) {
+		t.Errorf("white tile with a red tint has color %v, want red", got)
+	}
+	if got := pixelAt(gameMap.Layers[1].render(gameMap, false), 8, 8); got != white {
+		t.Errorf("white tile without tint has color %v", got)
+	}
+}
+
+func TestLayerOffset(t *testing.T) {
+	tmx := testTMX(3, 3, strings.Replace(csvLayer(1, "shifted", 3, 3, 0, 0, 0, 0, 2, 0, 0, 0, 0), `height="3"`, `height="3" offsetx="5" offsety="-3"`, 1))
+	gameMap := loadTestMap(t, tmx)
+	rendered := gameMap.Layers[0].render(gameMap, false)
+
+	// the marker of the tile in cell 1,1 moves from 16,16 to 21,13
+	if got := pixelAt(rendered, 21, 13); got != white {
+		t.Errorf("marker not shifted to 21,13, found %v", got)
+	}
+	if got := pixelAt(rendered, 20, 13); got != (color.RGBA{}) {
+		t.Errorf("pixel left of the shifted tile has color %v", got)
+	}
+	if got := pixelAt(rendered, 36, 28); got != tileColor(1) {
+		t.Errorf("bottom right pixel of the shifted tile has color %v, want %v", got, tileColor(1))
+	}
+	if got := pixelAt(rendered, 37, 29); got != (color.RGBA{}) {
+		t.Errorf("pixel beyond the shifted tile has color %v", got)
+	}
+}
+
+func TestImageLayerOffset(t *testing.T) {
+	fsys := newTestFS(testTMX(4, 2, ` <imagelayer id="1" name="sky" offsetx="20" offsety="8">
+  <image source="sky.png" width="16" height="16"/>
+ </imagelayer>
+`))
+	fsys["sky.png"] = &fstest.MapFile{Data: tilesetPNG(1, 1, 16, 16)}
+	gameMap := loadTestMapFS(t, fsys)
+	if len(gameMap.ImageLayers) != 1 || gameMap.ImageLayers[0].EbitenImage == nil {
+		t.Fatal("image layer wasn't loaded")
+	}
+	rendered := gameMap.ImageLayers[0].render(gameMap, false)
+
+	// the marker in the image's top left corner is drawn at the offset
+	if got := pixelAt(rendered, 20, 8); got != white {
+		t.Errorf("marker not drawn at 20,8, found %v", got)
+	}
+	if got := pixelAt(rendered, 35, 23); got != tileColor(0) {
+		t.Errorf("bottom right pixel of the image has color %v, want %v", got, tileColor(0))
+	}
+	for _, p := range []image.Point{{19, 8}, {20, 7}, {36, 23}, {0, 0}} {
+		if got := pixelAt(rendered, p.X, p.Y); got != (color.RGBA{}) {
+			t.Errorf("pixel %v outside of the image has color %v", p, got)
+		}
+	}
+}
+
+func TestRenderOrderOversizedTiles(t *testing.T) {
+	// 32x32 tiles on a 16x16 grid overlap their right and upper neighbors, all four cover 20,4
+	tsx := strings.NewReplacer(`tilewidth="16" tileheight="16"`, `tilewidth="32" tileheight="32"`,
+		`width="64" height="64"`, `width="128" height="128"`).Replace(testTSX(""))
+	tests := []struct {
+		order RenderOrder
+		cells []image.Point
+	}{
+		{RightDown, []image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}}},
+		{RightUp, []image.Point{{0, 1}, {1, 1}, {0, 0}, {1, 0}}},
+		{LeftDown, []image.Point{{1, 0}, {0, 0}, {1, 1}, {0, 1}}},
+		{LeftUp, []image.Point{{1, 1}, {0, 1}, {1, 0}, {0, 0}}},
+	}
+	for _, test := range tests {
+		tmx := strings.Replace(testTMX(2, 2, csvLayer(1, "ground", 2, 2, 1, 2, 3, 4)), `renderorder="right-down"`, `renderorder="`+string(test.order)+`"`, 1)
+		fsys := newTestFS(tmx)
+		fsys["tiles.tsx"].Data = []byte(tsx)
+		fsys["tiles.png"].Data = tilesetPNG(testTileColumns, testTileCount/testTileColumns, 32, 32)
+
+		var drawn []image.Point
+		gameMap := loadTestMapFS(t, fsys, WithTileDrawHook(func(tile *Tile, op *ebiten.DrawImageOptions) {
+			drawn = append(drawn, image.Pt(tile.X, tile.Y))
+		}))
+		rendered := gameMap.Layers[0].render(gameMap, false)
+
+		if fmt.Sprint(drawn) != fmt.Sprint(test.cells) {
+			t.Errorf("%s: tiles drawn in order %v, want %v", test.order, drawn, test.cells)
+		}
+		last := test.cells[len(test.cells)-1]
+		if got, want := pixelAt(rendered, 20, 4), tileColor(last.Y*2+last.X); got != want {
+			t.Errorf("%s: overlapped pixel has color %v, want the last drawn tile %v", test.order, got, want)
+		}
+	}
+}
+
+func BenchmarkRenderCamera(b *testing.B) {
+	gids := make([]uint32, 20*15)
+	for i := range gids {
+		gids[i] = uint32(i%testTileCount) + 1
+	}
+	gameMap := loadTestMap(b, testTMX(20, 15, csvLayer(1, "ground", 20, 15, gids...)))
+	gameMap.CameraBounds = image.Rect(0, 0, 160, 120)
+	gameMap.CameraPosition = image.Pt(80, 60)
+	layer := gameMap.Layers[0]
+	layer.Render(gameMap, 1, false)
+
+	// a still camera reuses the cached view of the render
+	b.Run("still", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			layer.Render(gameMap, 1, false)
+		}
+	})
+	b.Run("moving", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			gameMap.CameraPosition = image.Pt(80+i%64, 60)
+			layer.Render(gameMap, 1, false)
+		}
+	})
+}
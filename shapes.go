@@ -0,0 +1,53 @@
+package ebitmx
+
+import "image"
+
+// CollisionRects returns the collision rectangles the tileset defines for the tile of a tile object,
+// in world coordinates. The rectangles are flipped along with the tile and scaled to the object's size.
+// Object rotation is not applied. Returns nil if the object has no tile or the tile no collision shapes.
+func (o *Object) CollisionRects() []image.Rectangle {
+	if o.Tile == nil {
+		return nil
+	}
+	def := o.Tile.Definition()
+	if def == nil || def.ObjectGroup == nil {
+		return nil
+	}
+
+	tileWidth, tileHeight := o.Tile.Tileset.TileWidth, o.Tile.Tileset.TileHeight
+	_, flags := DecodeGID(o.Tile.GID())
+	scaleX, scaleY := 1.0, 1.0
+	if tileWidth > 0 && tileHeight > 0 && o.Width > 0 && o.Height > 0 {
+		scaleX = float64(o.Width) / float64(tileWidth)
+		scaleY = float64(o.Height) / float64(tileHeight)
+	}
+
+	// tile objects are positioned by their bottom left corner
+	origin := image.Pt(o.X, o.Y-int(float64(tileHeight)*scaleY))
+
+	var rects []image.Rectangle
+	for _, shape := range def.ObjectGroup.Objects {
+		r := flipRect(image.Rect(shape.X, shape.Y, shape.X+shape.Width, shape.Y+shape.Height), flags, tileWidth, tileHeight)
+		rects = append(rects, image.Rect(
+			int(float64(r.Min.X)*scaleX), int(float64(r.Min.Y)*scaleY),
+			int(float64(r.Max.X)*scaleX), int(float64(r.Max.Y)*scaleY),
+		).Add(origin))
+	}
+	return rects
+}
+
+// flipRect applies the flip flags to a rectangle within a tile of the given size,
+// in the same order as flipGeoM
+func flipRect(r image.Rectangle, flags TileFlags, width, height int) image.Rectangle {
+	if flags.Diagonal() {
+		r = image.Rect(r.Min.Y, r.Min.X, r.Max.Y, r.Max.X)
+		width, height = height, width
+	}
+	if flags.Horizontal() {
+		r = image.Rect(width-r.Max.X, r.Min.Y, width-r.Min.X, r.Max.Y)
+	}
+	if flags.Vertical() {
+		r = image.Rect(r.Min.X, height-r.Max.Y, r.Max.X, height-r.Min.Y)
+	}
+	return r
+}
@@ -0,0 +1,160 @@
+package ebitmx
+
+import (
+	"fmt"
+	"image"
+	"testing"
+)
+
+// collisionTSX gives tile 0 a collision rectangle covering its left quarter
+var collisionTSX = testTSX(` <tile id="0">
+  <objectgroup draworder="index" id="2">
+   <object id="1" x="0" y="0" width="4" height="16"/>
+  </objectgroup>
+ </tile>
+`)
+
+func TestObjectCollisionRectsFlipped(t *testing.T) {
+	fsys := newTestFS(testTMX(4, 4, fmt.Sprintf(` <objectgroup id="1" name="objects">
+  <object id="1" gid="1" x="32" y="48" width="16" height="16"/>
+  <object id="2" gid="%d" x="32" y="48" width="16" height="16"/>
+  <object id="3" gid="%d" x="0" y="64" width="32" height="32"/>
+ </objectgroup>
+`, 1|FLIPPED_HORIZONTALLY_FLAG, 1|FLIPPED_HORIZONTALLY_FLAG)))
+	fsys["tiles.tsx"].Data = []byte(collisionTSX)
+	gameMap := loadTestMapFS(t, fsys)
+
+	want := map[int]image.Rectangle{
+		1: image.Rect(32, 32, 36, 48),
+		2: image.Rect(44, 32, 48, 48),
+		3: image.Rect(24, 32, 32, 64),
+	}
+	for _, object := range gameMap.ObjectGroups[0].Objects {
+		rects := object.CollisionRects()
+		if len(rects) != 1 || rects[0] != want[object.ID] {
+			t.Errorf("object %d: collision rects %v, want %v", object.ID, rects, want[object.ID])
+		}
+	}
+}
+
+func TestFlipRect(t *testing.T) {
+	r := image.Rect(0, 0, 4, 8)
+	tests := []struct {
+		flags TileFlags
+		want  image.Rectangle
+	}{
+		{0, image.Rect(0, 0, 4, 8)},
+		{TileFlags(FLIPPED_HORIZONTALLY_FLAG), image.Rect(12, 0, 16, 8)},
+		{TileFlags(FLIPPED_VERTICALLY_FLAG), image.Rect(0, 8, 4, 16)},
+		{TileFlags(FLIPPED_HORIZONTALLY_FLAG) | TileFlags(FLIPPED_VERTICALLY_FLAG), image.Rect(12, 8, 16, 16)},
+		{TileFlags(FLIPPED_DIAGONALLY_FLAG), image.Rect(0, 0, 8, 4)},
+		{TileFlags(FLIPPED_DIAGONALLY_FLAG) | TileFlags(FLIPPED_HORIZONTALLY_FLAG), image.Rect(8, 0, 16, 4)},
+	}
+	for _, test := range tests {
+		if got := flipRect(r, test.flags, 16, 16); got != test.want {
+			t.Errorf("flipRect with flags %#x = %v, want %v", uint32(test.flags), got, test.want)
+		}
+	}
+}
+
+// shapesTMX holds one object of every shape, the triangle's right angle is at its top left
+var shapesTMX = testTMX(8, 8, ` <objectgroup id="1" name="shapes">
+  <object id="1" name="box" x="0" y="0" width="16" height="8"/>
+  <object id="2" name="triangle" x="32" y="32">
+   <polygon points="0,0 32,0 0,32"/>
+  </object>
+  <object id="3" name="path" x="0" y="64">
+   <polyline points="0,0 16,8 32,0"/>
+  </object>
+  <object id="4" name="round" x="64" y="0" width="32" height="16">
+   <ellipse/>
+  </object>
+  <object id="5" name="spawn" x="100" y="100">
+   <point/>
+  </object>
+ </objectgroup>
+`)
+
+func TestObjectShapes(t *testing.T) {
+	gameMap := loadTestMap(t, shapesTMX)
+
+	want := map[string]struct {
+		shape  ObjectShape
+		points PointList
+		bounds image.Rectangle
+	}{
+		"box":      {ShapeRectangle, nil, image.Rect(0, 0, 16, 8)},
+		"triangle": {ShapePolygon, PointList{{0, 0}, {32, 0}, {0, 32}}, image.Rect(32, 32, 64, 64)},
+		"path":     {ShapePolyline, PointList{{0, 0}, {16, 8}, {32, 0}}, image.Rect(0, 64, 32, 72)},
+		"round":    {ShapeEllipse, nil, image.Rect(64, 0, 96, 16)},
+		"spawn":    {ShapePoint, nil, image.Rect(100, 100, 100, 100)},
+	}
+	for _, object := range gameMap.ObjectGroups[0].Objects {
+		w := want[object.Name]
+		if shape := object.Shape(); shape != w.shape {
+			t.Errorf("%s: shape %s, want %s", object.Name, shape, w.shape)
+		}
+		var points PointList
+		if object.Polygon != nil {
+			points = object.Polygon.Points
+		} else if object.Polyline != nil {
+			points = object.Polyline.Points
+		}
+		if fmt.Sprint(points) != fmt.Sprint(w.points) {
+			t.Errorf("%s: points %v, want %v", object.Name, points, w.points)
+		}
+		if bounds := object.Bounds(); bounds != w.bounds {
+			t.Errorf("%s: bounds %v, want %v", object.Name, bounds, w.bounds)
+		}
+	}
+}
+
+func TestCheckColisionEllipse(t *testing.T) {
+	gameMap := loadTestMap(t, shapesTMX)
+	gameMap.SetCollisionGroups("shapes")
+
+	// the ellipse "round" is centered at 80,8 with radii 16 and 8
+	tests := []struct {
+		name    string
+		subject image.Rectangle
+		want    bool
+	}{
+		{"center", image.Rect(78, 6, 82, 10), true},
+		{"left tip", image.Rect(60, 6, 66, 10), true},
+		{"top left corner of the bounds", image.Rect(64, 0, 67, 2), false},
+		{"bottom right corner of the bounds", image.Rect(93, 14, 96, 16), false},
+		{"beyond the bounds", image.Rect(97, 6, 100, 10), false},
+	}
+	for _, test := range tests {
+		if got := gameMap.CheckColision(test.subject); got != test.want {
+			t.Errorf("%s: CheckColision(%v) = %t, want %t", test.name, test.subject, got, test.want)
+		}
+	}
+}
+
+func TestPointInPolygon(t *testing.T) {
+	gameMap := loadTestMap(t, shapesTMX)
+	gameMap.SetCollisionGroups("shapes")
+
+	tests := []struct {
+		p    image.Point
+		want bool
+	}{
+		{image.Pt(36, 36), true},
+		{image.Pt(40, 50), true},
+		// within the bounding box, but beyond the hypotenuse
+		{image.Pt(60, 60), false},
+		{image.Pt(50, 50), false},
+		{image.Pt(30, 40), false},
+		// the polyline and the point have no area
+		{image.Pt(16, 66), false},
+		{image.Pt(100, 100), false},
+		{image.Pt(80, 8), true},
+		{image.Pt(65, 1), false},
+	}
+	for _, test := range tests {
+		if got := gameMap.CheckColisionPoint(test.p); got != test.want {
+			t.Errorf("CheckColisionPoint(%v) = %t, want %t", test.p, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package ebitmx
+
+import "time"
+
+// LoadStats reports how long the phases of LoadFromFile took
+type LoadStats struct {
+	// XMLParse covers reading and unmarshaling the map file
+	XMLParse time.Duration
+	// TilesetLoad covers loading tilesets, excluding the image decoding
+	TilesetLoad time.Duration
+	// ImageDecode covers decoding the tileset images
+	ImageDecode time.Duration
+	// LayerDecode covers decoding the tile data of all layers
+	LayerDecode time.Duration
+	Total       time.Duration
+
+	Tilesets int
+	// Tiles counts the decoded tiles, it's 0 with WithLazyDecode as the layers are decoded on first use
+	Tiles int
+}
+
+// WithLoadStats fills stats with the timings and counts of the load, replacing their previous content.
+// Reload fills them again.
+func WithLoadStats(stats *LoadStats) LoadOption {
+	return func(o *loadOptions) {
+		o.stats = stats
+	}
+}
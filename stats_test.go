@@ -0,0 +1,49 @@
+package ebitmx
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadStats(t *testing.T) {
+	stats := &LoadStats{}
+	loadTestMap(t, testTMX(2, 2, csvLayer(1, "ground", 2, 2, 1, 0, 2, 3)), WithLoadStats(stats))
+
+	if stats.Tilesets != 1 || stats.Tiles != 3 {
+		t.Errorf("stats count %d tilesets and %d tiles, want 1 and 3", stats.Tilesets, stats.Tiles)
+	}
+	if stats.Total <= 0 || stats.ImageDecode <= 0 {
+		t.Errorf("stats have total %s and image decode %s", stats.Total, stats.ImageDecode)
+	}
+	phases := stats.XMLParse + stats.TilesetLoad + stats.ImageDecode + stats.LayerDecode
+	if phases > stats.Total {
+		t.Errorf("phases sum up to %s, more than the total %s", phases, stats.Total)
+	}
+	for name, d := range map[string]time.Duration{"XMLParse": stats.XMLParse, "TilesetLoad": stats.TilesetLoad, "LayerDecode": stats.LayerDecode} {
+		if d < 0 {
+			t.Errorf("%s is negative", name)
+		}
+	}
+}
+
+func TestLoadStatsReload(t *testing.T) {
+	dir := writeTestFiles(t, newTestFS(testTMX(2, 2, csvLayer(1, "ground", 2, 2, 1, 0, 2, 3))))
+	path := filepath.Join(dir, "map.tmx")
+	stats := &LoadStats{}
+	gameMap, err := LoadFromFile(path, WithLoadStats(stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gameMap.Reload(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stats cover the reload only instead of adding up
+	if stats.Tilesets != 1 || stats.Tiles != 3 {
+		t.Errorf("stats count %d tilesets and %d tiles after reloading, want 1 and 3", stats.Tilesets, stats.Tiles)
+	}
+	if stats.TilesetLoad < 0 || stats.ImageDecode > stats.Total {
+		t.Errorf("stats have tileset load %s and image decode %s of %s total", stats.TilesetLoad, stats.ImageDecode, stats.Total)
+	}
+}
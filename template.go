@@ -0,0 +1,144 @@
+package ebitmx
+
+import (
+	"encoding/xml"
+	"io/fs"
+)
+
+// Template is an object template stored in a .tx file
+type Template struct {
+	XMLName xml.Name `xml:"template"`
+	// Tileset is the tileset of a tile object template, its firstgid only applies to Object.Gid
+	Tileset *Tileset `xml:"tileset"`
+	Object  *Object  `xml:"object"`
+
+	path string
+}
+
+func loadTemplate(fsys fs.FS, path string) (*Template, error) {
+	data, err := readFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	template := &Template{path: path}
+	if err := xml.Unmarshal(data, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// templateLoader loads the templates referenced by the objects of a map, reading each file once
+type templateLoader struct {
+	gameMap   *TmxMap
+	dir       string
+	templates map[string]*Template
+}
+
+func (l *templateLoader) load(source string) (*Template, error) {
+	path, err := resolveFile(l.gameMap.options.fsys, l.dir, source)
+	if err != nil {
+		return nil, err
+	}
+	if template, ok := l.templates[path]; ok {
+		return template, nil
+	}
+	template, err := loadTemplate(l.gameMap.options.fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	if template.Tileset != nil {
+		template.Tileset.sourceResolver = l.gameMap.options.sourceResolver
+		template.Tileset.fsys = l.gameMap.options.fsys
+		template.Tileset.maxDecompressedSize = l.gameMap.options.maxDecompressedSize
+	}
+	l.templates[path] = template
+	return template, nil
+}
+
+// apply fills in the attributes of a templated object from its template. Attributes set on the object
+// itself take precedence, properties are merged.
+func (l *templateLoader) apply(object *Object) error {
+	if object.Template == "" {
+		return nil
+	}
+	template, err := l.load(object.Template)
+	if err != nil {
+		return err
+	}
+	if template.Object == nil {
+		return nil
+	}
+
+	defaults := template.Object
+	if object.Name == "" {
+		object.Name = defaults.Name
+	}
+	if object.Type == "" {
+		object.Type = defaults.Type
+	}
+	if object.Width == 0 && object.Height == 0 {
+		object.Width, object.Height = defaults.Width, defaults.Height
+	}
+	if object.Rotation == 0 {
+		object.Rotation = defaults.Rotation
+	}
+	object.Visible = object.Visible && defaults.Visible
+	if object.Polygon == nil && object.Polyline == nil && object.Ellipse == nil && object.Point == nil {
+		object.Polygon, object.Polyline = defaults.Polygon, defaults.Polyline
+		object.Ellipse, object.Point = defaults.Ellipse, defaults.Point
+	}
+	if len(defaults.Properties) > 0 {
+		merged := make(Properties, len(defaults.Properties)+len(object.Properties))
+		for name, prop := range defaults.Properties {
+			merged[name] = prop
+		}
+		for name, prop := range object.Properties {
+			merged[name] = prop
+		}
+		object.Properties = merged
+	}
+
+	return l.resolveTile(object, template)
+}
+
+// resolveTile resolves the gid of a templated tile object. The template's gid refers to the template's
+// own tileset, so it is remapped to the map's firstgid of that tileset. If the map doesn't use the
+// tileset, it is loaded on its own and the object's Tile refers to it, leaving Gid 0.
+// A gid set on the object itself already refers to the map's tilesets.
+func (l *templateLoader) resolveTile(object *Object, template *Template) error {
+	if object.Gid != 0 || template.Object.Gid == 0 || template.Tileset == nil {
+		return nil
+	}
+
+	id, flags := DecodeGID(template.Object.Gid)
+	fsys := l.gameMap.options.fsys
+	templateDir := fileDir(fsys, template.path)
+	tsxPath, err := resolveFile(fsys, templateDir, template.Tileset.resolveSource(template.Tileset.Source))
+	if err != nil {
+		return err
+	}
+	for _, tileset := range l.gameMap.Tilesets {
+		if tileset.Source == "" {
+			continue
+		}
+		path, err := resolveFile(fsys, l.dir, tileset.resolveSource(tileset.Source))
+		if err != nil {
+			return err
+		}
+		if path == tsxPath {
+			object.Gid = (id - template.Tileset.FirstGid + tileset.FirstGid) | uint32(flags)
+			return nil
+		}
+	}
+
+	if template.Tileset.Tiles == nil {
+		if err := template.Tileset.LoadFromTsx(templateDir); err != nil {
+			return err
+		}
+	}
+	tile := TileFromGID(template.Object.Gid)
+	tile.Tileset = template.Tileset
+	tile.InternalTileID = id - template.Tileset.FirstGid
+	object.Tile = tile
+	return nil
+}
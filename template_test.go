@@ -0,0 +1,101 @@
+package ebitmx
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// chestTX is a tile object template in a subdirectory bringing the test tileset at firstgid 1
+const chestTX = `<?xml version="1.0" encoding="UTF-8"?>
+<template>
+ <tileset firstgid="1" source="../tiles.tsx"/>
+ <object name="chest" type="container" gid="3" width="16" height="16"/>
+</template>
+`
+
+func TestTemplateTileset(t *testing.T) {
+	objects := ` <objectgroup id="2" name="objects">
+  <object id="1" template="templates/chest.tx" x="0" y="16"/>
+ </objectgroup>
+`
+	// the map uses the template's tileset at another firstgid
+	tmx := strings.Replace(testTMX(1, 1, objects), `firstgid="1"`, `firstgid="5"`, 1)
+	fsys := newTestFS(tmx)
+	fsys["templates/chest.tx"] = &fstest.MapFile{Data: []byte(chestTX)}
+	gameMap := loadTestMapFS(t, fsys)
+
+	chest := gameMap.GetObjectByID(1)
+	if chest.Gid != 7 || chest.Tile == nil || chest.Tile.InternalTileID != 2 {
+		t.Fatalf("templated object has gid %d and tile %+v, want gid 7 for tile 2", chest.Gid, chest.Tile)
+	}
+	dst := ebiten.NewImage(16, 16)
+	if err := gameMap.DrawTileByGID(dst, chest.Gid, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := pixelAt(dst, 8, 8); got != tileColor(2) {
+		t.Errorf("templated object renders %v, want tile 2 %v", got, tileColor(2))
+	}
+
+	// the map doesn't use the template's tileset at all
+	fsys = newTestFS(strings.Replace(tmx, ` <tileset firstgid="5" source="tiles.tsx"/>
+`, "", 1))
+	fsys["templates/chest.tx"] = &fstest.MapFile{Data: []byte(chestTX)}
+	chest = loadTestMapFS(t, fsys).GetObjectByID(1)
+	if chest.Tile == nil || chest.Tile.InternalTileID != 2 {
+		t.Fatalf("object of the template's own tileset has tile %+v, want tile 2", chest.Tile)
+	}
+	dst.Clear()
+	dst.DrawImage(chest.Tile.Tileset.TileImage(int(chest.Tile.InternalTileID), 0), nil)
+	if got := pixelAt(dst, 8, 8); got != tileColor(2) {
+		t.Errorf("object of the template's own tileset renders %v, want %v", got, tileColor(2))
+	}
+}
+
+func TestTemplateObject(t *testing.T) {
+	fsys := newTestFS(testTMX(4, 4, ` <objectgroup id="2" name="objects">
+  <object id="1" template="templates/crate.tx" x="16" y="32"/>
+  <object id="2" template="templates/crate.tx" name="heavy crate" x="32" y="32" width="32" height="32">
+   <properties>
+    <property name="weight" type="int" value="9"/>
+   </properties>
+  </object>
+ </objectgroup>
+`))
+	fsys["templates/crate.tx"] = &fstest.MapFile{Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<template>
+ <object name="crate" type="pushable" width="16" height="24" rotation="90">
+  <properties>
+   <property name="weight" type="int" value="3"/>
+   <property name="material" value="wood"/>
+  </properties>
+ </object>
+</template>
+`)}
+	gameMap := loadTestMapFS(t, fsys)
+
+	crate := gameMap.GetObjectByID(1)
+	if crate.Name != "crate" || crate.Type != "pushable" || crate.Width != 16 || crate.Height != 24 || crate.Rotation != 90 {
+		t.Errorf("templated object is %+v, want the template's name, type, size and rotation", crate)
+	}
+	if crate.X != 16 || crate.Y != 32 {
+		t.Errorf("templated object is at %d,%d, want 16,32", crate.X, crate.Y)
+	}
+	if weight, _ := crate.Properties.GetInt("weight"); weight != 3 {
+		t.Errorf("templated object has weight %d, want 3", weight)
+	}
+
+	// attributes and properties set on the object override the template's
+	heavy := gameMap.GetObjectByID(2)
+	if heavy.Name != "heavy crate" || heavy.Type != "pushable" || heavy.Width != 32 || heavy.Height != 32 {
+		t.Errorf("overriding object is %+v", heavy)
+	}
+	if weight, _ := heavy.Properties.GetInt("weight"); weight != 9 {
+		t.Errorf("overriding object has weight %d, want 9", weight)
+	}
+	if material, _ := heavy.Properties.GetString("material"); material != "wood" {
+		t.Errorf("overriding object has material %q, want the template's wood", material)
+	}
+}
@@ -0,0 +1,162 @@
+package ebitmx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Verify checks that the map at path parses, that the tilesets, templates and images it references
+// exist and that it passes Validate, without decoding any images.
+// All problems found are combined into the returned error.
+func Verify(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	gameMap := &TmxMap{options: newLoadOptions(nil)}
+	if err := xml.Unmarshal(data, gameMap); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	var problems []string
+	for _, tileset := range gameMap.Tilesets {
+		if tileset.Source == "" {
+			if tileset.Image == nil && !tileset.hasTileImages() {
+				problems = append(problems, fmt.Sprintf("inline tileset '%s' has no image", tileset.Name))
+			}
+			problems = append(problems, checkTilesetImages(dir, tileset.Image, tileset.TileDefinitions, "inline tileset '"+tileset.Name+"'")...)
+			continue
+		}
+		tsxFile, absTSXPath, err := tileset.parseTsx(dir)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		image := &tsxFile.Image
+		if image.Source == "" && image.Data == nil {
+			image = nil
+		}
+		problems = append(problems, checkTilesetImages(filepath.Dir(absTSXPath), image, tsxFile.Tiles, "tileset '"+absTSXPath+"'")...)
+	}
+
+	for _, layer := range gameMap.ImageLayers {
+		if err := checkImage(dir, layer.Image); err != nil {
+			problems = append(problems, fmt.Sprintf("image layer '%s': image %s", layer.Name, err))
+		}
+	}
+
+	checked := make(map[string]bool)
+	for _, group := range gameMap.ObjectGroups {
+		for _, object := range group.Objects {
+			if object.Template == "" || checked[object.Template] {
+				continue
+			}
+			checked[object.Template] = true
+			if err := checkTemplate(resolvePath(dir, object.Template)); err != nil {
+				problems = append(problems, fmt.Sprintf("object %d: template %s", object.ID, err))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		for _, layer := range gameMap.Layers {
+			if err := layer.DecodeData(gameMap); err != nil {
+				problems = append(problems, fmt.Sprintf("layer '%s': %s", layer.Name, err))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		if err := gameMap.Validate(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %s", path, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkTilesetImages checks that the image of a tileset located in dir exists,
+// or the images of its tiles for image collection tilesets
+func checkTilesetImages(dir string, image *ImageSource, tiles []*TilesetTile, name string) []string {
+	var problems []string
+	if image != nil {
+		if err := checkImage(dir, image); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: image %s", name, err))
+		}
+		return problems
+	}
+	for _, tile := range tiles {
+		if err := checkImage(dir, tile.Image); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: tile %d: image %s", name, tile.ID, err))
+		}
+	}
+	return problems
+}
+
+// checkImage checks that the file of an image referenced from a file in dir exists.
+// Embedded and missing images pass.
+func checkImage(dir string, image *ImageSource) error {
+	if image == nil || image.Data != nil || image.Source == "" {
+		return nil
+	}
+	_, err := os.Stat(resolvePath(dir, image.Source))
+	return err
+}
+
+// checkTemplate checks that the template at path parses and that its tileset exists
+func checkTemplate(path string) error {
+	template, err := loadTemplate(nil, path)
+	if err != nil {
+		return err
+	}
+	if template.Tileset != nil && template.Tileset.Source != "" {
+		if _, err := os.Stat(resolvePath(filepath.Dir(path), template.Tileset.Source)); err != nil {
+			return fmt.Errorf("'%s': tileset %s", path, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the consistency of a decoded map: tileset gid ranges and that every tile
+// and tile object resolves to a tileset.
+func (t *TmxMap) Validate() error {
+	var problems []string
+
+	for i, tileset := range t.Tilesets {
+		if tileset.FirstGid == 0 {
+			problems = append(problems, fmt.Sprintf("tileset %s has invalid firstgid 0", tileset.describe(i)))
+		} else if i > 0 && tileset.FirstGid < t.Tilesets[i-1].FirstGid+uint32(t.Tilesets[i-1].tileIDLimit()) {
+			problems = append(problems, fmt.Sprintf("tileset %s overlaps the gids of %s", tileset.describe(i), t.Tilesets[i-1].describe(i-1)))
+		}
+	}
+
+	for _, layer := range t.Layers {
+		layer.ensureDecoded()
+		for _, tile := range layer.Tiles {
+			if tile.Tileset == nil || tile.Tileset == t.placeholder {
+				problems = append(problems, fmt.Sprintf("layer '%s': unresolved gid %d at %d,%d", layer.Name, tile.GlobalTileID, tile.X, tile.Y))
+			}
+		}
+	}
+
+	for _, group := range t.ObjectGroups {
+		for _, object := range group.Objects {
+			if object.Gid != 0 && t.TilesetForGID(object.Gid&GID_MASK) == nil {
+				problems = append(problems, fmt.Sprintf("object %d: unresolved gid %d", object.ID, object.Gid&GID_MASK))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package ebitmx
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestVerify(t *testing.T) {
+	valid := newTestFS(testTMX(2, 1, csvLayer(1, "ground", 2, 1, 1, 2)+` <imagelayer id="2" name="sky">
+  <image source="sky.png" width="16" height="16"/>
+ </imagelayer>
+ <objectgroup id="3" name="objects">
+  <object id="1" template="chest.tx" x="0" y="16"/>
+ </objectgroup>
+`))
+	valid["sky.png"] = &fstest.MapFile{Data: tilesetPNG(1, 1, 16, 16)}
+	valid["chest.tx"] = &fstest.MapFile{Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<template>
+ <tileset firstgid="1" source="tiles.tsx"/>
+ <object gid="3" width="16" height="16"/>
+</template>
+`)}
+	dir := writeTestFiles(t, valid)
+	if err := Verify(filepath.Join(dir, "map.tmx")); err != nil {
+		t.Fatalf("valid map failed verification: %s", err)
+	}
+
+	for _, missing := range []string{"tiles.png", "sky.png", "chest.tx"} {
+		t.Run(missing, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for name, file := range valid {
+				if name != missing {
+					fsys[name] = file
+				}
+			}
+			dir := writeTestFiles(t, fsys)
+			err := Verify(filepath.Join(dir, "map.tmx"))
+			if err == nil {
+				t.Fatalf("missing %s passed verification", missing)
+			}
+			if !strings.Contains(err.Error(), missing) {
+				t.Errorf("error does not name %s: %s", missing, err)
+			}
+		})
+	}
+}
+
+func TestVerifyImageCollection(t *testing.T) {
+	fsys := newTestFS(testTMX(1, 1, csvLayer(1, "ground", 1, 1, 1)))
+	fsys["tiles.tsx"] = &fstest.MapFile{Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<tileset version="1.8" tiledversion="1.8.2" name="tiles" tilewidth="16" tileheight="16" tilecount="1" columns="0">
+ <tile id="0">
+  <image source="tree.png" width="16" height="16"/>
+ </tile>
+</tileset>
+`)}
+	dir := writeTestFiles(t, fsys)
+	err := Verify(filepath.Join(dir, "map.tmx"))
+	if err == nil || !strings.Contains(err.Error(), "tree.png") {
+		t.Errorf("missing collection image not reported: %v", err)
+	}
+}